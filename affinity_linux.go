@@ -0,0 +1,17 @@
+package vm
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func schedSetaffinity(tid int, cpus []int) error {
+	var set unix.CPUSet
+
+	set.Zero()
+
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+
+	return unix.SchedSetaffinity(tid, &set)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package vm
+
+import (
+	"errors"
+)
+
+func schedSetaffinity(tid int, cpus []int) error {
+	return errors.New("CPU pinning is only supported on Linux")
+}
@@ -0,0 +1,31 @@
+package vm
+
+import (
+	"context"
+	"errors"
+)
+
+// Resizes the memory of the guest through its balloon driver, the memory
+// given back is reclaimed by the host. The target can't exceed MegMemory.
+func (vm *VM) SetBalloon(ctx context.Context, megabytes int) error {
+	if !vm.Config.Balloon {
+		return errors.New("The VM has no balloon device")
+	}
+
+	if megabytes <= 0 || megabytes > vm.Config.MegMemory {
+		return errors.New("The balloon target must be between 1M and the memory of the VM")
+	}
+
+	return vm.qmp.Balloon(ctx, int64(megabytes)<<20)
+}
+
+// Memory of the guest as reported by the balloon driver, in megabytes
+func (vm *VM) QueryBalloon(ctx context.Context) (int, error) {
+	if !vm.Config.Balloon {
+		return 0, errors.New("The VM has no balloon device")
+	}
+
+	balloon, err := vm.qmp.QueryBalloon(ctx)
+
+	return int(balloon.Actual >> 20), err
+}
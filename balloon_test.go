@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+
+	schnappsqmp "github.com/bytearena/schnapps/qmp"
+	"github.com/bytearena/schnapps/qmp/qmptest"
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBalloon(t *testing.T) {
+	server, err := qmptest.NewServer()
+	require.Nil(t, err)
+	defer server.Close()
+
+	actual := int64(1024 << 20)
+
+	server.Handle("balloon", func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+		var arguments struct {
+			Value int64 `json:"value"`
+		}
+
+		if err := json.Unmarshal(args, &arguments); err != nil {
+			return nil, &schnappsqmp.Error{Class: schnappsqmp.ERROR_CLASS_GENERIC, Desc: err.Error()}
+		}
+
+		atomic.StoreInt64(&actual, arguments.Value)
+
+		return struct{}{}, nil
+	})
+
+	server.Handle("query-balloon", func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+		return schnappsqmp.BalloonInfo{Actual: atomic.LoadInt64(&actual)}, nil
+	})
+
+	vm := NewVM(types.VMConfig{MegMemory: 1024, Balloon: true})
+	vm.Config.QMPServer = server.Config()
+	vm.setState(StateStarting)
+
+	ctx := context.Background()
+
+	require.Nil(t, vm.connect(ctx))
+	defer vm.Close()
+
+	megabytes, err := vm.QueryBalloon(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, megabytes, 1024)
+
+	assert.Nil(t, vm.SetBalloon(ctx, 256))
+
+	megabytes, err = vm.QueryBalloon(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, megabytes, 256)
+
+	assert.NotNil(t, vm.SetBalloon(ctx, 2048))
+	assert.NotNil(t, vm.SetBalloon(ctx, 0))
+}
+
+func TestBalloonNoDevice(t *testing.T) {
+	vm := NewVM(types.VMConfig{MegMemory: 1024})
+	ctx := context.Background()
+
+	assert.NotNil(t, vm.SetBalloon(ctx, 512))
+
+	_, err := vm.QueryBalloon(ctx)
+	assert.NotNil(t, err)
+}
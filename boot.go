@@ -0,0 +1,153 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+)
+
+var (
+	BOOT_TIMEOUT       = time.Duration(60 * time.Second)
+	BOOT_POLL_INTERVAL = time.Duration(500 * time.Millisecond)
+
+	ErrNoBootCheck = errors.New("Cannot wait for boot: no boot check configured")
+)
+
+// Returned when none of the boot checks succeeded before the deadline.
+type BootTimeoutError struct {
+	Id  int
+	Err error
+}
+
+func (e *BootTimeoutError) Error() string {
+	return fmt.Sprintf("VM %d did not boot: %s", e.Id, e.Err.Error())
+}
+
+func (e *BootTimeoutError) Timeout() bool {
+	return true
+}
+
+func (vm *VM) compileBootMarker() error {
+	if vm.Config.Boot.ConsoleMarker == "" {
+		return nil
+	}
+
+	marker, err := regexp.Compile(vm.Config.Boot.ConsoleMarker)
+
+	if err != nil {
+		return errors.New("Invalid boot console marker: " + err.Error())
+	}
+
+	vm.bootMarker = marker
+
+	return nil
+}
+
+func (vm *VM) detectBoot(line []byte) {
+	if vm.bootMarker == nil || !vm.bootMarker.Match(line) {
+		return
+	}
+
+	vm.bootedOnce.Do(func() {
+		close(vm.booted)
+	})
+}
+
+// Blocks until one of the configured boot checks succeeds or the
+// Config.Boot.Timeout (BOOT_TIMEOUT by default) expires.
+func (vm *VM) WaitUntilBooted() error {
+	timeout := vm.Config.Boot.Timeout
+
+	if timeout == 0 {
+		timeout = BOOT_TIMEOUT
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return vm.WaitUntilBootedContext(ctx)
+}
+
+// Blocks until one of the configured boot checks succeeds or the context is
+// done, in which case a *BootTimeoutError is returned.
+func (vm *VM) WaitUntilBootedContext(ctx context.Context) error {
+	check := vm.Config.Boot
+
+	if check.ConsoleMarker == "" && check.TCPAddr == "" && !check.GuestAgent && check.Probe == nil {
+		return ErrNoBootCheck
+	}
+
+	if check.GuestAgent && vm.Config.GuestAgent == nil {
+		return ErrNoGuestAgent
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	booted := make(chan struct{}, 4)
+
+	if check.ConsoleMarker != "" {
+		go func() {
+			select {
+			case <-vm.booted:
+				booted <- struct{}{}
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	if check.TCPAddr != "" {
+		go vm.pollBootProbe(ctx, booted, func(ctx context.Context) error {
+			var dialer net.Dialer
+
+			conn, err := dialer.DialContext(ctx, "tcp", check.TCPAddr)
+
+			if err != nil {
+				return err
+			}
+
+			return conn.Close()
+		})
+	}
+
+	if check.GuestAgent {
+		go vm.pollBootProbe(ctx, booted, vm.pingGuestAgent)
+	}
+
+	if check.Probe != nil {
+		go vm.pollBootProbe(ctx, booted, check.Probe)
+	}
+
+	select {
+	case <-booted:
+		return nil
+	case <-vm.exited:
+		return fmt.Errorf("VM %d did not boot: %w", vm.Config.Id, ErrProcessExited)
+	case <-ctx.Done():
+		return &BootTimeoutError{Id: vm.Config.Id, Err: ctx.Err()}
+	}
+}
+
+func (vm *VM) pollBootProbe(ctx context.Context, booted chan struct{}, probe func(ctx context.Context) error) {
+	interval := vm.Config.Boot.PollInterval
+
+	if interval == 0 {
+		interval = BOOT_POLL_INTERVAL
+	}
+
+	for {
+		if err := probe(ctx); err == nil {
+			booted <- struct{}{}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
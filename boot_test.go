@@ -0,0 +1,79 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitUntilBootedConsoleMarker(t *testing.T) {
+	vm := NewVM(types.VMConfig{
+		Boot: types.BootCheck{ConsoleMarker: "^Welcome to .*$"},
+	})
+	assert.Nil(t, vm.compileBootMarker())
+
+	reader, writer := io.Pipe()
+	go vm.readStdout(reader)
+
+	go func() {
+		writer.Write([]byte("Booting kernel...\n"))
+		writer.Write([]byte("Welcome to LinuxKit\n"))
+		writer.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.Nil(t, vm.WaitUntilBootedContext(ctx))
+}
+
+func TestWaitUntilBootedTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	vm := NewVM(types.VMConfig{
+		Boot: types.BootCheck{
+			TCPAddr:      listener.Addr().String(),
+			PollInterval: time.Millisecond,
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.Nil(t, vm.WaitUntilBootedContext(ctx))
+}
+
+func TestWaitUntilBootedTimeout(t *testing.T) {
+	vm := NewVM(types.VMConfig{
+		Id: 1,
+		Boot: types.BootCheck{
+			Probe: func(ctx context.Context) error {
+				return errors.New("not ready")
+			},
+			PollInterval: time.Millisecond,
+			Timeout:      10 * time.Millisecond,
+		},
+	})
+
+	err := vm.WaitUntilBooted()
+
+	bootErr, ok := err.(*BootTimeoutError)
+	require.True(t, ok)
+	assert.Equal(t, bootErr.Id, 1)
+	assert.Equal(t, bootErr.Err, context.DeadlineExceeded)
+}
+
+func TestWaitUntilBootedNoCheck(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+
+	assert.Equal(t, vm.WaitUntilBooted(), ErrNoBootCheck)
+}
@@ -0,0 +1,52 @@
+package vm
+
+import (
+	"context"
+
+	"github.com/bytearena/schnapps/cli"
+	"github.com/bytearena/schnapps/launcher"
+	"github.com/bytearena/schnapps/logger"
+)
+
+// Capabilities of the QEMU binary running the VM, probed before it is
+// launched. The QMP commands are known once the VM is started.
+func (vm *VM) Capabilities() *cli.Capabilities {
+	return vm.capabilities
+}
+
+func (vm *VM) probeCapabilities(l launcher.Launcher) error {
+	prober, ok := l.(launcher.Prober)
+
+	if !ok {
+		vm.capabilities = &cli.Capabilities{}
+
+		return nil
+	}
+
+	caps, err := prober.Probe(vm.Config)
+
+	if err != nil {
+		return err
+	}
+
+	vm.capabilities = caps
+
+	return nil
+}
+
+func (vm *VM) probeCommands(ctx context.Context) {
+	commands, err := vm.qmp.QueryCommands(ctx)
+
+	if err != nil {
+		vm.log().Warn("Could not query the QMP commands", logger.KEY_ERROR, err)
+		return
+	}
+
+	names := make([]string, len(commands))
+
+	for i, command := range commands {
+		names[i] = command.Name
+	}
+
+	vm.capabilities.SetCommands(names)
+}
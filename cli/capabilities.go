@@ -0,0 +1,245 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	PROBE_TIMEOUT = time.Duration(10 * time.Second)
+
+	versionRegexp     = regexp.MustCompile(`version (\d+)\.(\d+)(?:\.(\d+))?`)
+	optionRegexp      = regexp.MustCompile(`^-([a-z0-9-]+)`)
+	deviceNameRegexp  = regexp.MustCompile(`name "([^"]+)"`)
+	deviceAliasRegexp = regexp.MustCompile(`alias "([^"]+)"`)
+
+	probeCache      = make(map[string]*Capabilities)
+	probeCacheMutex sync.Mutex
+)
+
+type Version struct {
+	Major int
+	Minor int
+	Micro int
+}
+
+func (v Version) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Micro)
+}
+
+// Features supported by a QEMU binary. The zero value means that the
+// capabilities are unknown, everything is assumed to be supported and legacy
+// flags are used.
+type Capabilities struct {
+	Version Version
+
+	options  map[string]bool
+	devices  map[string]bool
+	machines map[string]bool
+
+	mutex    sync.RWMutex
+	commands map[string]bool
+}
+
+// Whether the binary was probed
+func (c *Capabilities) Known() bool {
+	return c != nil && c.Version.Major > 0
+}
+
+// Command line option, without the leading dash
+func (c *Capabilities) HasOption(name string) bool {
+	return !c.Known() || c.options[name]
+}
+
+// Device name or alias, as listed by -device help
+func (c *Capabilities) HasDevice(name string) bool {
+	return !c.Known() || c.devices[name]
+}
+
+// Machine type or alias, as listed by -machine help
+func (c *Capabilities) HasMachine(name string) bool {
+	return !c.Known() || c.machines[name]
+}
+
+// QMP command, as listed by query-commands. The commands are only known once
+// a VM using the binary is connected.
+func (c *Capabilities) HasCommand(name string) bool {
+	if c == nil {
+		return true
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.commands == nil || c.commands[name]
+}
+
+// Records the result of QMP query-commands
+func (c *Capabilities) SetCommands(names []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.commands = make(map[string]bool)
+
+	for _, name := range names {
+		c.commands[name] = true
+	}
+}
+
+// Probes the capabilities of the QEMU binary, the result is cached for each
+// binary.
+func Probe(kvmbin string) (*Capabilities, error) {
+	probeCacheMutex.Lock()
+	defer probeCacheMutex.Unlock()
+
+	if caps, ok := probeCache[kvmbin]; ok {
+		return caps, nil
+	}
+
+	caps, err := probe(kvmbin)
+
+	if err != nil {
+		return nil, err
+	}
+
+	probeCache[kvmbin] = caps
+
+	return caps, nil
+}
+
+func probe(kvmbin string) (*Capabilities, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), PROBE_TIMEOUT)
+	defer cancel()
+
+	run := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, kvmbin, args...)
+		cmd.Env = nil
+
+		out, err := cmd.Output()
+
+		if err != nil {
+			return "", fmt.Errorf("Could not probe %s %s: %v", kvmbin, strings.Join(args, " "), err)
+		}
+
+		return string(out), nil
+	}
+
+	out, err := run("-version")
+
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := parseVersion(out)
+
+	if err != nil {
+		return nil, err
+	}
+
+	caps := &Capabilities{Version: version}
+
+	if out, err = run("-help"); err != nil {
+		return nil, err
+	}
+
+	caps.options = parseOptions(out)
+
+	if out, err = run("-device", "help"); err != nil {
+		return nil, err
+	}
+
+	caps.devices = parseDevices(out)
+
+	if out, err = run("-machine", "help"); err != nil {
+		return nil, err
+	}
+
+	caps.machines = parseMachines(out)
+
+	return caps, nil
+}
+
+// QEMU emulator version 2.8.1(Debian 1:2.8+dfsg-6+deb9u9)
+func parseVersion(out string) (Version, error) {
+	match := versionRegexp.FindStringSubmatch(out)
+
+	if match == nil {
+		return Version{}, fmt.Errorf("Could not parse QEMU version: %s", strings.TrimSpace(out))
+	}
+
+	v := Version{}
+	v.Major, _ = strconv.Atoi(match[1])
+	v.Minor, _ = strconv.Atoi(match[2])
+
+	if match[3] != "" {
+		v.Micro, _ = strconv.Atoi(match[3])
+	}
+
+	return v, nil
+}
+
+// -accel [accel=]accelerator[,prop[=value][,...]]
+func parseOptions(out string) map[string]bool {
+	options := make(map[string]bool)
+
+	eachLine(out, func(line string) {
+		if match := optionRegexp.FindStringSubmatch(line); match != nil {
+			options[match[1]] = true
+		}
+	})
+
+	return options
+}
+
+// name "virtio-net-pci", bus PCI, alias "virtio-net"
+func parseDevices(out string) map[string]bool {
+	devices := make(map[string]bool)
+
+	eachLine(out, func(line string) {
+		if match := deviceNameRegexp.FindStringSubmatch(line); match != nil {
+			devices[match[1]] = true
+		}
+
+		if match := deviceAliasRegexp.FindStringSubmatch(line); match != nil {
+			devices[match[1]] = true
+		}
+	})
+
+	return devices
+}
+
+// pc                   Standard PC (i440FX + PIIX, 1996) (alias of pc-i440fx-2.8)
+func parseMachines(out string) map[string]bool {
+	machines := make(map[string]bool)
+
+	eachLine(out, func(line string) {
+		fields := strings.Fields(line)
+
+		if len(fields) == 0 || strings.HasSuffix(line, ":") {
+			return
+		}
+
+		machines[fields[0]] = true
+	})
+
+	return machines
+}
+
+func eachLine(out string, fn func(line string)) {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+
+	for scanner.Scan() {
+		fn(scanner.Text())
+	}
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	versionOutput = `QEMU emulator version 2.8.1(Debian 1:2.8+dfsg-6+deb9u9)
+Copyright (c) 2003-2016 Fabrice Bellard and the QEMU Project developers
+`
+
+	helpOutput = `QEMU emulator version 2.8.1(Debian 1:2.8+dfsg-6+deb9u9)
+usage: qemu-system-x86_64 [options] [disk_image]
+
+Standard options:
+-h or -help     display this help and exit
+-machine [type=]name[,prop[=value][,...]]
+                selects emulated machine ('-machine help' for list)
+-no-fd-bootchk  disable boot signature checking for floppy disks
+-netdev tap,id=str[,fd=h][,fds=x:y:...:z][,ifname=name][,script=file]
+`
+
+	deviceOutput = `Controller/Bridge/Hub devices:
+name "pci-bridge", bus PCI, desc "Standard PCI Bridge"
+
+Network devices:
+name "e1000", bus PCI, alias "e1000-82540em", desc "Intel Gigabit Ethernet"
+name "virtio-net-pci", bus PCI, alias "virtio-net"
+`
+
+	machineOutput = `Supported machines are:
+pc                   Standard PC (i440FX + PIIX, 1996) (alias of pc-i440fx-2.8)
+pc-i440fx-2.8        Standard PC (i440FX + PIIX, 1996) (default)
+q35                  Standard PC (Q35 + ICH9, 2009) (alias of pc-q35-2.8)
+none                 empty machine
+`
+)
+
+func TestParseVersion(t *testing.T) {
+	v, err := parseVersion(versionOutput)
+	assert.Nil(t, err)
+	assert.Equal(t, v, Version{2, 8, 1})
+	assert.True(t, v.AtLeast(2, 8))
+	assert.True(t, v.AtLeast(1, 9))
+	assert.False(t, v.AtLeast(2, 9))
+
+	v, err = parseVersion("QEMU emulator version 6.0 (foo)")
+	assert.Nil(t, err)
+	assert.Equal(t, v, Version{6, 0, 0})
+
+	_, err = parseVersion("kvm: command not found")
+	assert.NotNil(t, err)
+}
+
+func TestParseHelp(t *testing.T) {
+	options := parseOptions(helpOutput)
+	assert.True(t, options["machine"])
+	assert.True(t, options["no-fd-bootchk"])
+	assert.True(t, options["netdev"])
+	assert.False(t, options["accel"])
+	// Continuation lines
+	assert.False(t, options["selects"])
+
+	devices := parseDevices(deviceOutput)
+	assert.Equal(t, devices, map[string]bool{
+		"pci-bridge":     true,
+		"e1000":          true,
+		"e1000-82540em":  true,
+		"virtio-net-pci": true,
+		"virtio-net":     true,
+	})
+
+	machines := parseMachines(machineOutput)
+	assert.Equal(t, machines, map[string]bool{
+		"pc":            true,
+		"pc-i440fx-2.8": true,
+		"q35":           true,
+		"none":          true,
+	})
+}
+
+func TestCapabilitiesUnknown(t *testing.T) {
+	var caps *Capabilities
+
+	assert.False(t, caps.Known())
+	assert.True(t, caps.HasOption("accel"))
+	assert.True(t, caps.HasMachine("q35"))
+	assert.True(t, caps.HasCommand("quit"))
+
+	caps = &Capabilities{}
+	assert.True(t, caps.HasDevice("virtio-net"))
+	assert.True(t, caps.HasCommand("quit"))
+
+	caps.SetCommands([]string{"quit"})
+	assert.True(t, caps.HasCommand("quit"))
+	assert.False(t, caps.HasCommand("device_add"))
+}
+
+func TestProbe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	outputs := map[string]string{
+		"version": versionOutput,
+		"help":    helpOutput,
+		"device":  deviceOutput,
+		"machine": machineOutput,
+	}
+
+	for name, out := range outputs {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(out), 0644))
+	}
+
+	// Fake QEMU binary, counting its calls
+	kvmbin := filepath.Join(dir, "qemu")
+	script := `#!/bin/sh
+echo >> ` + filepath.Join(dir, "calls") + `
+cat ` + dir + `/$(echo "$1" | tr -d -)
+`
+	assert.Nil(t, ioutil.WriteFile(kvmbin, []byte(script), 0755))
+
+	caps, err := Probe(kvmbin)
+	assert.Nil(t, err)
+	assert.True(t, caps.Known())
+	assert.Equal(t, caps.Version, Version{2, 8, 1})
+	assert.True(t, caps.HasOption("no-fd-bootchk"))
+	assert.False(t, caps.HasOption("accel"))
+	assert.True(t, caps.HasDevice("virtio-net"))
+	assert.True(t, caps.HasMachine("q35"))
+	assert.False(t, caps.HasMachine("microvm"))
+
+	cached, err := Probe(kvmbin)
+	assert.Nil(t, err)
+	assert.True(t, cached == caps)
+
+	calls, err := ioutil.ReadFile(filepath.Join(dir, "calls"))
+	assert.Nil(t, err)
+	assert.Equal(t, len(calls), 4)
+
+	_, err = Probe(filepath.Join(dir, "missing"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bytearena/schnapps/types"
+)
+
+func checkCPU(config types.VMConfig) error {
+	if len(config.CPUFlags) > 0 && config.CPUModel == "" {
+		return errors.New("CPU flags require a CPU model")
+	}
+
+	if config.CPUModel == "host" && config.Accelerator == types.AcceleratorTCG {
+		return errors.New("The host CPU model requires KVM")
+	}
+
+	for _, flag := range config.CPUFlags {
+		if !strings.HasPrefix(flag, "+") && !strings.HasPrefix(flag, "-") {
+			return fmt.Errorf("CPU flag %s must start with + or -", flag)
+		}
+	}
+
+	for vcpu, cpus := range config.CPUPinning {
+		if vcpu < 0 || vcpu >= config.CPUAmount {
+			return fmt.Errorf("Pinning: vCPU %d doesn't exist", vcpu)
+		}
+
+		if len(cpus) == 0 {
+			return fmt.Errorf("Pinning: vCPU %d has no host CPU", vcpu)
+		}
+	}
+
+	if len(config.NUMANodes) == 0 {
+		return nil
+	}
+
+	memory := 0
+	assigned := make(map[int]bool)
+
+	for i, node := range config.NUMANodes {
+		if len(node.CPUs) == 0 || node.MegMemory <= 0 {
+			return fmt.Errorf("NUMA node %d needs CPUs and memory", i)
+		}
+
+		for _, cpu := range node.CPUs {
+			if cpu < 0 || cpu >= config.CPUAmount {
+				return fmt.Errorf("NUMA node %d: vCPU %d doesn't exist", i, cpu)
+			}
+
+			if assigned[cpu] {
+				return fmt.Errorf("NUMA node %d: vCPU %d is already assigned", i, cpu)
+			}
+
+			assigned[cpu] = true
+		}
+
+		memory += node.MegMemory
+	}
+
+	if memory != config.MegMemory {
+		return fmt.Errorf("The memory of the NUMA nodes (%dM) doesn't match the memory of the VM (%dM)", memory, config.MegMemory)
+	}
+
+	return nil
+}
+
+func buildSMPArgs(config types.VMConfig) []string {
+	smp := strconv.Itoa(config.CPUAmount)
+
+	if config.CPUSocketAmount > 0 {
+		smp += ",sockets=" + strconv.Itoa(config.CPUSocketAmount)
+	}
+
+	if config.CPUCoreAmount > 0 {
+		smp += ",cores=" + strconv.Itoa(config.CPUCoreAmount)
+	}
+
+	if config.CPUThreadAmount > 0 {
+		smp += ",threads=" + strconv.Itoa(config.CPUThreadAmount)
+	}
+
+	return []string{"-smp", smp}
+}
+
+func buildCPUArgs(config types.VMConfig) []string {
+	if config.CPUModel == "" {
+		return []string{}
+	}
+
+	return []string{"-cpu", strings.Join(append([]string{config.CPUModel}, config.CPUFlags...), ",")}
+}
+
+func buildNUMAArgs(config types.VMConfig) []string {
+	args := []string{}
+
+	for i, node := range config.NUMANodes {
+		id := "mem" + strconv.Itoa(i)
+
+		args = append(
+			args,
+			"-object", memoryBackend(config.Memory, id, node.MegMemory),
+			"-numa", "node,nodeid="+strconv.Itoa(i)+","+cpuRanges(node.CPUs)+",memdev="+id,
+		)
+	}
+
+	return args
+}
+
+// cpus=0-3,cpus=6
+func cpuRanges(cpus []int) string {
+	sorted := append([]int{}, cpus...)
+	sort.Ints(sorted)
+
+	ranges := []string{}
+
+	for i := 0; i < len(sorted); {
+		j := i
+
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+
+		if i == j {
+			ranges = append(ranges, "cpus="+strconv.Itoa(sorted[i]))
+		} else {
+			ranges = append(ranges, "cpus="+strconv.Itoa(sorted[i])+"-"+strconv.Itoa(sorted[j]))
+		}
+
+		i = j + 1
+	}
+
+	return strings.Join(ranges, ",")
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildCPUArgs(t *testing.T) {
+	config := types.VMConfig{
+		MegMemory:       2048,
+		CPUAmount:       8,
+		CPUSocketAmount: 2,
+		CPUCoreAmount:   2,
+		CPUThreadAmount: 2,
+		CPUModel:        "Skylake-Server",
+		CPUFlags:        []string{"+avx2", "-hypervisor"},
+		NUMANodes: []types.NUMANode{
+			{CPUs: []int{0, 1, 2, 3}, MegMemory: 1024},
+			{CPUs: []int{7, 4, 5}, MegMemory: 1024},
+		},
+	}
+
+	assert.Nil(t, checkCPU(config))
+
+	assert.Equal(t, buildSMPArgs(config), []string{"-smp", "8,sockets=2,cores=2,threads=2"})
+	assert.Equal(t, buildCPUArgs(config), []string{"-cpu", "Skylake-Server,+avx2,-hypervisor"})
+	assert.Equal(t, buildNUMAArgs(config), []string{
+		"-object", "memory-backend-ram,id=mem0,size=1024M",
+		"-numa", "node,nodeid=0,cpus=0-3,memdev=mem0",
+		"-object", "memory-backend-ram,id=mem1,size=1024M",
+		"-numa", "node,nodeid=1,cpus=4-5,cpus=7,memdev=mem1",
+	})
+}
+
+func TestBuildCPUArgsDefault(t *testing.T) {
+	config := types.VMConfig{CPUAmount: 1, CPUCoreAmount: 1}
+
+	assert.Equal(t, buildSMPArgs(config), []string{"-smp", "1,cores=1"})
+	assert.Equal(t, buildCPUArgs(config), []string{})
+	assert.Equal(t, buildNUMAArgs(config), []string{})
+
+	// QEMU computes the missing topology values
+	assert.Equal(t, buildSMPArgs(types.VMConfig{CPUAmount: 4}), []string{"-smp", "4"})
+	assert.Equal(t, buildSMPArgs(types.VMConfig{CPUAmount: 4, CPUThreadAmount: 2}), []string{"-smp", "4,threads=2"})
+}
+
+func TestCheckCPU(t *testing.T) {
+	invalid := []types.VMConfig{
+		{CPUFlags: []string{"+avx2"}},
+		{CPUModel: "host", Accelerator: types.AcceleratorTCG},
+		{CPUModel: "max", CPUFlags: []string{"avx2"}},
+		// vCPU out of range
+		{CPUAmount: 2, MegMemory: 512, NUMANodes: []types.NUMANode{{CPUs: []int{0, 2}, MegMemory: 512}}},
+		// vCPU in two nodes
+		{CPUAmount: 2, MegMemory: 512, NUMANodes: []types.NUMANode{
+			{CPUs: []int{0, 1}, MegMemory: 256},
+			{CPUs: []int{1}, MegMemory: 256},
+		}},
+		// Memory mismatch
+		{CPUAmount: 2, MegMemory: 1024, NUMANodes: []types.NUMANode{{CPUs: []int{0, 1}, MegMemory: 512}}},
+		// Pinned vCPU out of range
+		{CPUAmount: 2, CPUPinning: map[int][]int{2: {4}}},
+		{CPUAmount: 2, CPUPinning: map[int][]int{-1: {4}}},
+		// Pinned to no host CPU
+		{CPUAmount: 2, CPUPinning: map[int][]int{0: {}}},
+	}
+
+	for i, config := range invalid {
+		assert.NotNil(t, checkCPU(config), i)
+	}
+
+	assert.Nil(t, checkCPU(types.VMConfig{CPUModel: "host", Accelerator: types.AcceleratorKVM}))
+	assert.Nil(t, checkCPU(types.VMConfig{CPUAmount: 2, CPUPinning: map[int][]int{0: {2}, 1: {3, 4}}}))
+}
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bytearena/schnapps/types"
+)
+
+var (
+	DEFAULT_DISK_CACHE = "none"
+
+	diskCacheModes = map[string]bool{
+		"none":         true,
+		"writeback":    true,
+		"writethrough": true,
+		"directsync":   true,
+		"unsafe":       true,
+	}
+
+	diskAIOModes = map[string]bool{
+		"threads":  true,
+		"native":   true,
+		"io_uring": true,
+	}
+
+	// QEMU device of each interface
+	diskDevices = map[types.DiskInterface]string{
+		types.DiskInterfaceVirtio: "virtio-blk-pci",
+		types.DiskInterfaceSCSI:   "scsi-hd",
+		types.DiskInterfaceNVMe:   "nvme",
+	}
+)
+
+// Disks of the config, the image of ImageLocation first
+func configDisks(config types.VMConfig) []types.Disk {
+	disks := []types.Disk{}
+
+	if config.ImageLocation != "" {
+		disks = append(disks, types.Disk{Path: config.ImageLocation})
+	}
+
+	return append(disks, config.Disks...)
+}
+
+func diskInterface(disk types.Disk) types.DiskInterface {
+	if disk.Interface == "" {
+		return types.DiskInterfaceVirtio
+	}
+
+	return disk.Interface
+}
+
+func checkDisk(disk types.Disk, machine string, caps *Capabilities) error {
+	if disk.Path == "" {
+		return errors.New("Disk has no path")
+	}
+
+	switch disk.Format {
+	case "", types.DiskFormatRaw, types.DiskFormatQCOW2:
+	default:
+		return fmt.Errorf("Disk %s: unknown format %s", disk.Path, disk.Format)
+	}
+
+	if disk.Cache != "" && !diskCacheModes[disk.Cache] {
+		return fmt.Errorf("Disk %s: unknown cache mode %s", disk.Path, disk.Cache)
+	}
+
+	if disk.AIO != "" && !diskAIOModes[disk.AIO] {
+		return fmt.Errorf("Disk %s: unknown AIO mode %s", disk.Path, disk.AIO)
+	}
+
+	if cache := diskCache(disk); disk.AIO == "native" && cache != "none" && cache != "directsync" {
+		return fmt.Errorf("Disk %s: native AIO requires the none or directsync cache mode", disk.Path)
+	}
+
+	switch disk.Persistence {
+	case "", types.DiskEphemeral, types.DiskPersistent:
+	case types.DiskOverlay:
+		return fmt.Errorf("Disk %s: the overlay must be created before launching the VM", disk.Path)
+	default:
+		return fmt.Errorf("Disk %s: unknown persistence %s", disk.Path, disk.Persistence)
+	}
+
+	iface := diskInterface(disk)
+	device, ok := diskDevices[iface]
+
+	if !ok {
+		return fmt.Errorf("Disk %s: unknown interface %s", disk.Path, iface)
+	}
+
+	device = machineDevice(machine, device)
+
+	if !caps.HasDevice(device) {
+		return unsupported(caps, "disk interface "+string(iface))
+	}
+
+	if err := checkMachineDevice(machine, device); err != nil {
+		return err
+	}
+
+	if iface == types.DiskInterfaceSCSI && !caps.HasDevice("virtio-scsi-pci") {
+		return unsupported(caps, "device virtio-scsi-pci")
+	}
+
+	return nil
+}
+
+func diskCache(disk types.Disk) string {
+	if disk.Cache == "" {
+		return DEFAULT_DISK_CACHE
+	}
+
+	return disk.Cache
+}
+
+func buildDiskArgs(disks []types.Disk, machine string) []string {
+	args := []string{}
+	hasSCSI := false
+
+	for i, disk := range disks {
+		id := "disk" + strconv.Itoa(i)
+
+		format := disk.Format
+
+		if format == "" {
+			format = types.DiskFormatRaw
+		}
+
+		drive := []string{
+			"file=" + escapeOption(disk.Path),
+			"if=none",
+			"id=" + id,
+			"format=" + string(format),
+			"cache=" + diskCache(disk),
+		}
+
+		if disk.ReadOnly {
+			drive = append(drive, "readonly=on")
+		}
+
+		ephemeral := disk.Persistence == "" || disk.Persistence == types.DiskEphemeral
+
+		// Writes go to a temporary overlay, discarded on exit
+		if ephemeral && !disk.ReadOnly {
+			drive = append(drive, "snapshot=on")
+		}
+
+		if disk.AIO != "" {
+			drive = append(drive, "aio="+disk.AIO)
+		}
+
+		if disk.Discard {
+			drive = append(drive, "discard=unmap")
+		}
+
+		device := []string{machineDevice(machine, diskDevices[diskInterface(disk)]), "drive=" + id, "id=" + id + "-device"}
+
+		switch diskInterface(disk) {
+		case types.DiskInterfaceSCSI:
+			// A single controller for every SCSI disk
+			if !hasSCSI {
+				args = append(args, "-device", "virtio-scsi-pci,id=scsi0")
+				hasSCSI = true
+			}
+
+			device = append(device, "bus=scsi0.0")
+
+		case types.DiskInterfaceNVMe:
+			// Mandatory for NVMe controllers
+			if disk.Serial == "" {
+				disk.Serial = id
+			}
+		}
+
+		if disk.Serial != "" {
+			device = append(device, "serial="+escapeOption(disk.Serial))
+		}
+
+		if disk.BootOrder > 0 {
+			device = append(device, "bootindex="+strconv.Itoa(disk.BootOrder))
+		}
+
+		args = append(args, "-drive", strings.Join(drive, ","), "-device", strings.Join(device, ","))
+	}
+
+	return args
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildDiskArgs(t *testing.T) {
+	config := types.VMConfig{
+		ImageLocation: "/images/linuxkit.raw",
+		Disks: []types.Disk{
+			{
+				Path:      "/images/assets.qcow2",
+				Format:    types.DiskFormatQCOW2,
+				ReadOnly:  true,
+				Cache:     "writeback",
+				Serial:    "assets",
+				Interface: types.DiskInterfaceSCSI,
+			},
+			{
+				Path:      "/images/data.raw",
+				AIO:       "native",
+				Discard:   true,
+				Interface: types.DiskInterfaceSCSI,
+				BootOrder: 1,
+			},
+			{
+				Path:        "/images/scratch.raw",
+				Interface:   types.DiskInterfaceNVMe,
+				Persistence: types.DiskPersistent,
+			},
+		},
+	}
+
+	assert.Equal(t, buildDiskArgs(configDisks(config), ""), []string{
+		"-drive", "file=/images/linuxkit.raw,if=none,id=disk0,format=raw,cache=none,snapshot=on",
+		"-device", "virtio-blk-pci,drive=disk0,id=disk0-device",
+		"-device", "virtio-scsi-pci,id=scsi0",
+		"-drive", "file=/images/assets.qcow2,if=none,id=disk1,format=qcow2,cache=writeback,readonly=on",
+		"-device", "scsi-hd,drive=disk1,id=disk1-device,bus=scsi0.0,serial=assets",
+		"-drive", "file=/images/data.raw,if=none,id=disk2,format=raw,cache=none,snapshot=on,aio=native,discard=unmap",
+		"-device", "scsi-hd,drive=disk2,id=disk2-device,bus=scsi0.0,bootindex=1",
+		"-drive", "file=/images/scratch.raw,if=none,id=disk3,format=raw,cache=none",
+		"-device", "nvme,drive=disk3,id=disk3-device,serial=disk3",
+	})
+}
+
+func TestBuildDiskArgsEscaping(t *testing.T) {
+	disks := []types.Disk{{Path: "/images/a,snapshot=off.raw", Serial: "a,b"}}
+
+	assert.Equal(t, buildDiskArgs(disks, ""), []string{
+		"-drive", "file=/images/a,,snapshot=off.raw,if=none,id=disk0,format=raw,cache=none,snapshot=on",
+		"-device", "virtio-blk-pci,drive=disk0,id=disk0-device,serial=a,,b",
+	})
+}
+
+func TestCheckDisk(t *testing.T) {
+	assert.Nil(t, checkDisk(types.Disk{Path: "a.raw"}, "", nil))
+
+	invalid := []types.Disk{
+		{},
+		{Path: "a.vmdk", Format: "vmdk"},
+		{Path: "a.raw", Cache: "fast"},
+		{Path: "a.raw", AIO: "posix"},
+		{Path: "a.raw", AIO: "native", Cache: "writeback"},
+		{Path: "a.raw", Interface: "ide"},
+		{Path: "a.raw", Persistence: types.DiskOverlay},
+		{Path: "a.raw", Persistence: "forever"},
+	}
+
+	for _, disk := range invalid {
+		assert.NotNil(t, checkDisk(disk, "", nil), disk.Path)
+	}
+
+	caps := &Capabilities{
+		Version: Version{2, 8, 1},
+		devices: map[string]bool{"virtio-blk-pci": true, "scsi-hd": true},
+	}
+
+	err := checkDisk(types.Disk{Path: "a.raw", Interface: types.DiskInterfaceNVMe}, "", caps)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	err = checkDisk(types.Disk{Path: "a.raw", Interface: types.DiskInterfaceSCSI}, "", caps)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/bytearena/schnapps/types"
+)
+
+var (
+	DEFAULT_DISPLAY_ADDR = "127.0.0.1"
+
+	// Port of VNC display 0
+	VNC_BASE_PORT = 5900
+)
+
+func checkDisplay(config types.VMConfig, caps *Capabilities) error {
+	display := config.Display
+
+	if display == nil {
+		return nil
+	}
+
+	if config.MachineType == "microvm" {
+		return errors.New("Displays are not available on microvm")
+	}
+
+	switch display.Protocol {
+	case types.DisplayVNC:
+		if display.Socket == "" && display.Port < VNC_BASE_PORT {
+			return fmt.Errorf("VNC port %d is below %d", display.Port, VNC_BASE_PORT)
+		}
+
+	case types.DisplaySPICE:
+		if !caps.HasOption("spice") {
+			return unsupported(caps, "SPICE")
+		}
+
+		if display.Socket == "" && display.Port <= 0 {
+			return errors.New("The SPICE port must be allocated")
+		}
+
+	default:
+		return fmt.Errorf("Unknown display protocol %s", display.Protocol)
+	}
+
+	return nil
+}
+
+func buildDisplayArgs(display *types.Display) []string {
+	if display == nil {
+		return []string{"-nographic"}
+	}
+
+	addr := display.Addr
+
+	if addr == "" {
+		addr = DEFAULT_DISPLAY_ADDR
+	}
+
+	// The display is only served
+	args := []string{"-display", "none"}
+
+	switch display.Protocol {
+	case types.DisplayVNC:
+		opts := []string{}
+
+		if display.Socket != "" {
+			opts = append(opts, "unix:"+escapeOption(display.Socket))
+		} else {
+			opts = append(opts, hostOption(addr)+":"+strconv.Itoa(display.Port-VNC_BASE_PORT))
+		}
+
+		// Refuses the clients until the password is set through QMP
+		if display.Password != "" {
+			opts = append(opts, "password=on")
+		}
+
+		args = append(args, "-vnc", strings.Join(opts, ","))
+
+	case types.DisplaySPICE:
+		opts := []string{}
+
+		if display.Socket != "" {
+			opts = append(opts, "unix=on", "addr="+escapeOption(display.Socket))
+		} else {
+			opts = append(opts, "port="+strconv.Itoa(display.Port), "addr="+addr)
+		}
+
+		if display.Password == "" {
+			opts = append(opts, "disable-ticketing=on")
+		}
+
+		args = append(args, "-spice", strings.Join(opts, ","))
+	}
+
+	return args
+}
+
+// IPv6 addresses are bracketed
+func hostOption(addr string) string {
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		return "[" + addr + "]"
+	}
+
+	return addr
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildDisplayArgs(t *testing.T) {
+	assert.Equal(t, buildDisplayArgs(nil), []string{"-nographic"})
+
+	assert.Equal(t, buildDisplayArgs(&types.Display{
+		Protocol: types.DisplayVNC,
+		Port:     5901,
+	}), []string{"-display", "none", "-vnc", "127.0.0.1:1"})
+
+	assert.Equal(t, buildDisplayArgs(&types.Display{
+		Protocol: types.DisplayVNC,
+		Addr:     "::1",
+		Port:     5902,
+		Password: "secret",
+	}), []string{"-display", "none", "-vnc", "[::1]:2,password=on"})
+
+	assert.Equal(t, buildDisplayArgs(&types.Display{
+		Protocol: types.DisplayVNC,
+		Socket:   "/run/vm-1,vnc.sock",
+	}), []string{"-display", "none", "-vnc", "unix:/run/vm-1,,vnc.sock"})
+
+	assert.Equal(t, buildDisplayArgs(&types.Display{
+		Protocol: types.DisplaySPICE,
+		Port:     5930,
+	}), []string{"-display", "none", "-spice", "port=5930,addr=127.0.0.1,disable-ticketing=on"})
+
+	assert.Equal(t, buildDisplayArgs(&types.Display{
+		Protocol: types.DisplaySPICE,
+		Socket:   "/run/vm-1.sock",
+		Password: "secret",
+	}), []string{"-display", "none", "-spice", "unix=on,addr=/run/vm-1.sock"})
+}
+
+func TestCheckDisplay(t *testing.T) {
+	invalid := []types.VMConfig{
+		{Display: &types.Display{Protocol: "rdp", Port: 5900}},
+		{Display: &types.Display{Protocol: types.DisplayVNC, Port: 22}},
+		{Display: &types.Display{Protocol: types.DisplaySPICE}},
+		{Display: &types.Display{Protocol: types.DisplayVNC, Port: 5900}, MachineType: "microvm"},
+	}
+
+	for i, config := range invalid {
+		assert.NotNil(t, checkDisplay(config, nil), i)
+	}
+
+	caps := &Capabilities{
+		Version: Version{6, 2, 0},
+		options: map[string]bool{"vnc": true},
+	}
+
+	err := checkDisplay(types.VMConfig{Display: &types.Display{Protocol: types.DisplaySPICE, Port: 5930}}, caps)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	assert.Nil(t, checkDisplay(types.VMConfig{Display: &types.Display{Protocol: types.DisplayVNC, Socket: "vnc.sock"}}, caps))
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"errors"
+
+	"github.com/bytearena/schnapps/guestagent"
+	"github.com/bytearena/schnapps/types"
+)
+
+func checkGuestAgent(config types.VMConfig, caps *Capabilities) error {
+	if config.GuestAgent == nil {
+		return nil
+	}
+
+	if config.GuestAgent.Socket == "" {
+		return errors.New("The guest agent socket must be set")
+	}
+
+	if device := machineDevice(config.MachineType, "virtio-serial-pci"); !caps.HasDevice(device) {
+		return unsupported(caps, "guest agent channel "+device)
+	}
+
+	return nil
+}
+
+// Exposes the qemu-ga channel on a Unix socket. QEMU doesn't wait for a
+// client, the socket is reachable as soon as QEMU has started.
+func buildGuestAgentArgs(config types.VMConfig, caps *Capabilities) []string {
+	if config.GuestAgent == nil {
+		return []string{}
+	}
+
+	server := "server,nowait"
+
+	if caps.Known() && caps.Version.AtLeast(6, 0) {
+		server = "server=on,wait=off"
+	}
+
+	return []string{
+		"-chardev", "socket,id=qga0,path=" + escapeOption(config.GuestAgent.Socket) + "," + server,
+		"-device", machineDevice(config.MachineType, "virtio-serial-pci") + ",id=qga0-serial",
+		"-device", "virtserialport,bus=qga0-serial.0,chardev=qga0,name=" + guestagent.CHANNEL_NAME,
+	}
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildGuestAgentArgs(t *testing.T) {
+	assert.Equal(t, buildGuestAgentArgs(types.VMConfig{}, nil), []string{})
+
+	config := types.VMConfig{GuestAgent: &types.GuestAgent{Socket: "/run/vm-1,qga.sock"}}
+
+	assert.Equal(t, buildGuestAgentArgs(config, nil), []string{
+		"-chardev", "socket,id=qga0,path=/run/vm-1,,qga.sock,server,nowait",
+		"-device", "virtio-serial-pci,id=qga0-serial",
+		"-device", "virtserialport,bus=qga0-serial.0,chardev=qga0,name=org.qemu.guest_agent.0",
+	})
+
+	config.MachineType = "microvm"
+
+	assert.Equal(t, buildGuestAgentArgs(config, &Capabilities{Version: Version{6, 2, 0}}), []string{
+		"-chardev", "socket,id=qga0,path=/run/vm-1,,qga.sock,server=on,wait=off",
+		"-device", "virtio-serial-device,id=qga0-serial",
+		"-device", "virtserialport,bus=qga0-serial.0,chardev=qga0,name=org.qemu.guest_agent.0",
+	})
+}
+
+func TestCheckGuestAgent(t *testing.T) {
+	assert.Nil(t, checkGuestAgent(types.VMConfig{}, nil))
+	assert.NotNil(t, checkGuestAgent(types.VMConfig{GuestAgent: &types.GuestAgent{}}, nil))
+
+	caps := &Capabilities{
+		Version: Version{6, 2, 0},
+		devices: map[string]bool{"virtio-serial-pci": true},
+	}
+
+	config := types.VMConfig{GuestAgent: &types.GuestAgent{Socket: "qga.sock"}}
+	assert.Nil(t, checkGuestAgent(config, caps))
+
+	config.MachineType = "microvm"
+	assert.True(t, errors.Is(checkGuestAgent(config, caps), ErrUnsupported))
+}
@@ -1,96 +1,243 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 
 	"github.com/bytearena/schnapps/types"
 )
 
-func CreateKVMCommand(kvmbin string, config types.VMConfig) *exec.Cmd {
+var (
+	DEFAULT_NIC_MODEL = "virtio-net-pci"
+
+	ErrUnsupported = errors.New("Unsupported by QEMU")
+)
+
+// Builds the QEMU command of the VM. The flags are chosen according to the
+// capabilities of the binary (see Probe), nil capabilities are unknown and
+// legacy flags are used. Configurations that the binary doesn't support
+// return an error wrapping ErrUnsupported.
+func CreateKVMCommand(kvmbin string, config types.VMConfig, caps *Capabilities) (*exec.Cmd, error) {
+	if err := checkConfig(config, caps); err != nil {
+		return nil, err
+	}
 
 	args := []string{
 		"-name", strconv.Itoa(config.Id),
 		"-m", strconv.Itoa(config.MegMemory) + "M",
-		"-snapshot",
-		"-smp", strconv.Itoa(config.CPUAmount) + ",cores=" + strconv.Itoa(config.CPUCoreAmount),
-		"-nographic",
-		"-no-fd-bootchk",
-		"-drive", "file=" + config.ImageLocation + ",if=virtio,cache=none,format=raw,index=1",
+		// Serial console on stdio, without the monitor multiplexed on it
+		"-chardev", "stdio,id=console0,signal=off",
+		"-serial", "chardev:console0",
+		"-monitor", "none",
 	}
 
-	args = append(args, buildNetArgs(config.NICs)...)
-	args = append(args, buildQMPServer(config.QMPServer)...)
+	args = append(args, buildDisplayArgs(config.Display)...)
+	args = append(args, buildSMPArgs(config)...)
+	args = append(args, buildCPUArgs(config)...)
+	args = append(args, buildNUMAArgs(config)...)
+	args = append(args, buildMemoryArgs(config, caps)...)
+	args = append(args, buildBalloonArgs(config)...)
+
+	// Removed from recent versions
+	if caps.HasOption("no-fd-bootchk") {
+		args = append(args, "-no-fd-bootchk")
+	}
+
+	args = append(args, buildKernelArgs(config)...)
+	args = append(args, buildDiskArgs(configDisks(config), config.MachineType)...)
+	args = append(args, buildMachineArgs(config, caps)...)
+	args = append(args, buildFirmwareArgs(config.Firmware)...)
+	args = append(args, buildSMBIOSArgs(config.SMBIOS)...)
+	args = append(args, buildNetArgs(config.NICs, config.MachineType)...)
+	args = append(args, buildGuestAgentArgs(config, caps)...)
+	args = append(args, buildQMPServer(config.QMPServer, caps)...)
 
 	cmd := exec.Command(kvmbin, args...)
 	cmd.Env = nil
 
-	return cmd
+	return cmd, nil
+}
+
+func unsupported(caps *Capabilities, what string) error {
+	return fmt.Errorf("%w %s: %s", ErrUnsupported, caps.Version, what)
+}
+
+func checkConfig(config types.VMConfig, caps *Capabilities) error {
+	if config.MachineType != "" && !caps.HasMachine(config.MachineType) {
+		return unsupported(caps, "machine type "+config.MachineType)
+	}
+
+	if err := checkKernel(config); err != nil {
+		return err
+	}
+
+	if err := checkFirmware(config, caps); err != nil {
+		return err
+	}
+
+	if err := checkCPU(config); err != nil {
+		return err
+	}
+
+	if err := checkMemory(config, caps); err != nil {
+		return err
+	}
+
+	if err := checkDisplay(config, caps); err != nil {
+		return err
+	}
+
+	if err := checkGuestAgent(config, caps); err != nil {
+		return err
+	}
+
+	for _, disk := range configDisks(config) {
+		if err := checkDisk(disk, config.MachineType, caps); err != nil {
+			return err
+		}
+	}
+
+	for i, nic := range config.NICs {
+		dev := nic.Device()
+		model := nicModel(dev, config.MachineType)
+
+		if nic.Netdev() == "" {
+			return fmt.Errorf("NIC %d has no backend", i)
+		}
+
+		if !caps.HasDevice(model) {
+			return unsupported(caps, "NIC model "+model)
+		}
+
+		if err := checkMachineDevice(config.MachineType, model); err != nil {
+			return err
+		}
+
+		if dev.Queues > 1 && !strings.HasPrefix(model, "virtio-net") {
+			return fmt.Errorf("Multiqueue is only supported by virtio-net NICs, not %s", model)
+		}
+	}
+
+	return nil
+}
+
+func checkKernel(config types.VMConfig) error {
+	if config.Kernel == "" {
+		if config.Initrd != "" || config.Cmdline != "" {
+			return errors.New("An initrd or a kernel command line requires a kernel")
+		}
+
+		return nil
+	}
+
+	for _, file := range []string{config.Kernel, config.Initrd} {
+		if file == "" {
+			continue
+		}
+
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("Could not boot the kernel: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func buildKernelArgs(config types.VMConfig) []string {
+	args := []string{}
+
+	if config.Kernel != "" {
+		args = append(args, "-kernel", config.Kernel)
+	}
+
+	if config.Initrd != "" {
+		args = append(args, "-initrd", config.Initrd)
+	}
+
+	if config.Cmdline != "" {
+		args = append(args, "-append", config.Cmdline)
+	}
+
+	return args
 }
 
-func buildNetArgs(NICs []interface{}) []string {
+func buildMachineArgs(config types.VMConfig, caps *Capabilities) []string {
 	args := []string{}
+	opts := []string{}
 
-	for _, e := range NICs {
-		switch nic := e.(type) {
-		case types.NICBridge:
-			args = append(
-				args,
-				[]string{
-					"-netdev",
-					fmt.Sprintf("bridge,br=%s,id=net0", nic.Bridge),
-					"-device",
-					fmt.Sprintf("virtio-net,netdev=net0,mac=%s", nic.MAC),
-				}...,
-			)
-
-		case types.NICIface:
-			args = append(
-				args,
-				[]string{
-					"-net",
-					fmt.Sprintf("nic,model=%s", nic.Model),
-				}...,
-			)
-
-		case types.NICTap:
-			args = append(
-				args,
-				[]string{
-					"-net",
-					fmt.Sprintf("tap,ifname=%s,script=no,downscript=no", nic.Ifname),
-				}...,
-			)
-		case types.NICUser:
-			args = append(
-				args,
-				[]string{
-					"-net",
-					fmt.Sprintf("user,dhcpstart=%s,net=%s", nic.DHCPStart, nic.Net),
-				}...,
-			)
-		case types.NICSocket:
-			args = append(
-				args,
-				[]string{
-					"-net",
-					fmt.Sprintf("socket,connect=%s", nic.Connect),
-				}...,
-			)
-		default:
-			panic("Unknow NIC type")
+	if config.MachineType != "" {
+		opts = append(opts, "type="+config.MachineType)
+	}
+
+	switch config.Accelerator {
+	case types.AcceleratorKVM, types.AcceleratorTCG:
+		if caps.Known() && caps.HasOption("accel") {
+			args = append(args, "-accel", string(config.Accelerator))
+		} else {
+			opts = append(opts, "accel="+string(config.Accelerator))
 		}
 	}
 
+	if machineMemoryBackend(config, caps) {
+		opts = append(opts, "memory-backend=mem")
+	}
+
+	if len(opts) > 0 {
+		args = append(args, "-machine", strings.Join(opts, ","))
+	}
+
 	return args
 }
 
-func buildQMPServer(config *types.QMPServer) []string {
+func buildNetArgs(NICs []types.NIC, machine string) []string {
+	args := []string{}
+
+	for i, nic := range NICs {
+		id := "net" + strconv.Itoa(i)
+		dev := nic.Device()
+
+		args = append(args, "-netdev", nic.Netdev()+",id="+id)
+		device := []string{nicModel(dev, machine), "id=" + id, "netdev=" + id}
+
+		if dev.MAC != "" {
+			device = append(device, "mac="+dev.MAC)
+		}
+
+		if dev.Queues > 1 {
+			// A vector for each queue (rx and tx), plus config and control
+			device = append(device, "mq=on", "vectors="+strconv.Itoa(2*dev.Queues+2))
+		}
+
+		args = append(args, "-device", strings.Join(device, ","))
+	}
+
+	return args
+}
+
+func nicModel(dev types.NICDevice, machine string) string {
+	if dev.Model == "" {
+		return machineDevice(machine, DEFAULT_NIC_MODEL)
+	}
+
+	return dev.Model
+}
+
+func buildQMPServer(config *types.QMPServer, caps *Capabilities) []string {
 	args := []string{}
 
 	if config != nil {
-		return []string{"-qmp", config.Protocol + ":" + config.Addr + ",server"}
+		// The server flag must be a boolean since QEMU 6.0
+		server := "server"
+
+		if caps.Known() && caps.Version.AtLeast(6, 0) {
+			server = "server=on"
+		}
+
+		return []string{"-qmp", config.Protocol + ":" + config.Addr + "," + server}
 	}
 
 	return args
@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateKVMCommandLegacy(t *testing.T) {
+	config := types.VMConfig{
+		Accelerator: types.AcceleratorKVM,
+		MachineType: "q35",
+		QMPServer:   &types.QMPServer{Protocol: "tcp", Addr: "localhost:4444"},
+	}
+
+	cmd, err := CreateKVMCommand("kvm", config, nil)
+	assert.Nil(t, err)
+
+	assert.Contains(t, cmd.Args, "-no-fd-bootchk")
+	assert.Equal(t, argValue(cmd.Args, "-chardev"), "stdio,id=console0,signal=off")
+	assert.Equal(t, argValue(cmd.Args, "-serial"), "chardev:console0")
+	assert.Equal(t, argValue(cmd.Args, "-monitor"), "none")
+	assert.Equal(t, argValue(cmd.Args, "-machine"), "type=q35,accel=kvm")
+	assert.Equal(t, argValue(cmd.Args, "-qmp"), "tcp:localhost:4444,server")
+}
+
+func TestCreateKVMCommandModern(t *testing.T) {
+	caps := &Capabilities{
+		Version:  Version{6, 2, 0},
+		options:  map[string]bool{"accel": true},
+		machines: map[string]bool{"q35": true},
+	}
+
+	config := types.VMConfig{
+		Accelerator: types.AcceleratorTCG,
+		MachineType: "q35",
+		QMPServer:   &types.QMPServer{Protocol: "tcp", Addr: "localhost:4444"},
+	}
+
+	cmd, err := CreateKVMCommand("qemu-system-x86_64", config, caps)
+	assert.Nil(t, err)
+
+	assert.NotContains(t, cmd.Args, "-no-fd-bootchk")
+	assert.Equal(t, argValue(cmd.Args, "-accel"), "tcg")
+	assert.Equal(t, argValue(cmd.Args, "-machine"), "type=q35")
+	assert.Equal(t, argValue(cmd.Args, "-qmp"), "tcp:localhost:4444,server=on")
+}
+
+func TestCreateKVMCommandUnsupported(t *testing.T) {
+	caps := &Capabilities{
+		Version:  Version{2, 8, 1},
+		devices:  map[string]bool{"e1000": true},
+		machines: map[string]bool{"pc": true},
+	}
+
+	_, err := CreateKVMCommand("kvm", types.VMConfig{MachineType: "microvm"}, caps)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+	assert.Equal(t, err.Error(), "Unsupported by QEMU 2.8.1: machine type microvm")
+
+	_, err = CreateKVMCommand("kvm", types.VMConfig{
+		NICs: []types.NIC{types.NICBridge{Bridge: "br0"}},
+	}, caps)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	_, err = CreateKVMCommand("kvm", types.VMConfig{
+		NICs: []types.NIC{types.NICUser{Model: "e1000"}},
+	}, caps)
+	assert.Nil(t, err)
+}
+
+// Custom NIC without backend
+type deviceOnlyNIC struct{}
+
+func (nic deviceOnlyNIC) Netdev() string {
+	return ""
+}
+
+func (nic deviceOnlyNIC) Device() types.NICDevice {
+	return types.NICDevice{Model: "e1000"}
+}
+
+func TestCreateKVMCommandNICWithoutBackend(t *testing.T) {
+	_, err := CreateKVMCommand("kvm", types.VMConfig{
+		NICs: []types.NIC{types.NICUser{}, deviceOnlyNIC{}},
+	}, nil)
+	assert.Equal(t, err.Error(), "NIC 1 has no backend")
+}
+
+func TestBuildNetArgs(t *testing.T) {
+	args := buildNetArgs([]types.NIC{
+		types.NICBridge{Bridge: "br0", MAC: "00:f0:00:00:00:01"},
+		types.NICBridge{Bridge: "br1", Model: "e1000"},
+		types.NICTap{Ifname: "tap0", Queues: 4},
+		types.NICUser{Net: "10.0.2.0/24"},
+		types.NICSocket{Connect: "127.0.0.1:1234"},
+	}, "")
+
+	assert.Equal(t, args, []string{
+		"-netdev", "bridge,br=br0,id=net0",
+		"-device", "virtio-net-pci,id=net0,netdev=net0,mac=00:f0:00:00:00:01",
+		"-netdev", "bridge,br=br1,id=net1",
+		"-device", "e1000,id=net1,netdev=net1",
+		"-netdev", "tap,ifname=tap0,script=no,downscript=no,queues=4,id=net2",
+		"-device", "virtio-net-pci,id=net2,netdev=net2,mq=on,vectors=10",
+		"-netdev", "user,net=10.0.2.0/24,id=net3",
+		"-device", "virtio-net-pci,id=net3,netdev=net3",
+		"-netdev", "socket,connect=127.0.0.1:1234,id=net4",
+		"-device", "virtio-net-pci,id=net4,netdev=net4",
+	})
+}
+
+func TestCreateKVMCommandMultiqueue(t *testing.T) {
+	_, err := CreateKVMCommand("kvm", types.VMConfig{
+		NICs: []types.NIC{types.NICTap{Ifname: "tap0", Model: "e1000", Queues: 2}},
+	}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestCreateKVMCommandKernel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	kernel := filepath.Join(dir, "linuxkit-kernel")
+	initrd := filepath.Join(dir, "linuxkit-initrd.img")
+
+	for _, file := range []string{kernel, initrd} {
+		assert.Nil(t, ioutil.WriteFile(file, []byte{}, 0644))
+	}
+
+	cmd, err := CreateKVMCommand("kvm", types.VMConfig{
+		Kernel:  kernel,
+		Initrd:  initrd,
+		Cmdline: "console=ttyS0 metadata=10.0.0.1:8080",
+	}, nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, argValue(cmd.Args, "-kernel"), kernel)
+	assert.Equal(t, argValue(cmd.Args, "-initrd"), initrd)
+	assert.Equal(t, argValue(cmd.Args, "-append"), "console=ttyS0 metadata=10.0.0.1:8080")
+	assert.NotContains(t, cmd.Args, "-drive")
+
+	_, err = CreateKVMCommand("kvm", types.VMConfig{
+		Kernel: kernel,
+		Initrd: filepath.Join(dir, "missing"),
+	}, nil)
+	assert.NotNil(t, err)
+
+	_, err = CreateKVMCommand("kvm", types.VMConfig{Cmdline: "console=ttyS0"}, nil)
+	assert.NotNil(t, err)
+}
+
+// Value of the first occurrence of the flag
+func argValue(args []string, flag string) string {
+	for i, arg := range args[:len(args)-1] {
+		if arg == flag {
+			return args[i+1]
+		}
+	}
+
+	return ""
+}
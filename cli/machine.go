@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bytearena/schnapps/types"
+)
+
+var (
+	// microvm has no PCI bus, its virtio devices are on virtio-mmio
+	microvmDevices = map[string]string{
+		"virtio-net-pci":     "virtio-net-device",
+		"virtio-blk-pci":     "virtio-blk-device",
+		"virtio-balloon-pci": "virtio-balloon-device",
+		"virtio-serial-pci":  "virtio-serial-device",
+	}
+)
+
+// Device to use on the machine for the given device
+func machineDevice(machine, device string) string {
+	if machine == "microvm" {
+		if mmio, ok := microvmDevices[device]; ok {
+			return mmio
+		}
+	}
+
+	return device
+}
+
+func checkMachineDevice(machine, device string) error {
+	if machine == "microvm" && !strings.HasSuffix(device, "-device") {
+		return fmt.Errorf("Device %s is not available on microvm", device)
+	}
+
+	return nil
+}
+
+func checkFirmware(config types.VMConfig, caps *Capabilities) error {
+	if config.Firmware != nil {
+		if config.MachineType == "microvm" {
+			return errors.New("UEFI firmware is not available on microvm")
+		}
+
+		if _, err := os.Stat(config.Firmware.Code); err != nil {
+			return fmt.Errorf("Could not load the firmware: %v", err)
+		}
+	}
+
+	if config.SMBIOS != nil && len(config.SMBIOS.OEMStrings) > 0 && caps.Known() && !caps.Version.AtLeast(2, 12) {
+		return unsupported(caps, "SMBIOS OEM strings")
+	}
+
+	return nil
+}
+
+// The vars must be the copy of the VM
+func buildFirmwareArgs(firmware *types.Firmware) []string {
+	if firmware == nil {
+		return []string{}
+	}
+
+	args := []string{
+		"-drive", "if=pflash,format=raw,unit=0,readonly=on,file=" + escapeOption(firmware.Code),
+	}
+
+	if firmware.Vars != "" {
+		args = append(args, "-drive", "if=pflash,format=raw,unit=1,file="+escapeOption(firmware.Vars))
+	}
+
+	return args
+}
+
+func buildSMBIOSArgs(smbios *types.SMBIOS) []string {
+	args := []string{}
+
+	if smbios == nil {
+		return args
+	}
+
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"manufacturer", smbios.Manufacturer},
+		{"product", smbios.Product},
+		{"version", smbios.Version},
+		{"serial", smbios.Serial},
+		{"uuid", smbios.UUID},
+		{"sku", smbios.SKU},
+		{"family", smbios.Family},
+	}
+
+	opts := []string{"type=1"}
+
+	for _, field := range fields {
+		if field.value != "" {
+			opts = append(opts, field.name+"="+escapeOption(field.value))
+		}
+	}
+
+	if len(opts) > 1 {
+		args = append(args, "-smbios", strings.Join(opts, ","))
+	}
+
+	for _, value := range smbios.OEMStrings {
+		args = append(args, "-smbios", "type=11,value="+escapeOption(value))
+	}
+
+	return args
+}
+
+// Commas are doubled in option values
+func escapeOption(value string) string {
+	return strings.Replace(value, ",", ",,", -1)
+}
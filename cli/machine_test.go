@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildFirmwareArgs(t *testing.T) {
+	assert.Equal(t, buildFirmwareArgs(&types.Firmware{
+		Code: "/usr/share/OVMF/OVMF_CODE.fd",
+		Vars: "/var/lib/schnapps/vm-1/OVMF_VARS.fd",
+	}), []string{
+		"-drive", "if=pflash,format=raw,unit=0,readonly=on,file=/usr/share/OVMF/OVMF_CODE.fd",
+		"-drive", "if=pflash,format=raw,unit=1,file=/var/lib/schnapps/vm-1/OVMF_VARS.fd",
+	})
+
+	assert.Equal(t, buildFirmwareArgs(nil), []string{})
+}
+
+func TestBuildSMBIOSArgs(t *testing.T) {
+	assert.Equal(t, buildSMBIOSArgs(&types.SMBIOS{
+		Manufacturer: "Byte Arena",
+		Product:      "worker",
+		Serial:       "ds=nocloud;s=http://10.0.0.1/,v1",
+		OEMStrings:   []string{"io.systemd.credential:foo=bar"},
+	}), []string{
+		"-smbios", "type=1,manufacturer=Byte Arena,product=worker,serial=ds=nocloud;s=http://10.0.0.1/,,v1",
+		"-smbios", "type=11,value=io.systemd.credential:foo=bar",
+	})
+
+	assert.Equal(t, buildSMBIOSArgs(&types.SMBIOS{}), []string{})
+}
+
+func TestCreateKVMCommandMicroVM(t *testing.T) {
+	config := types.VMConfig{
+		MachineType:   "microvm",
+		ImageLocation: "/images/linuxkit.raw",
+		NICs:          []types.NIC{types.NICUser{}},
+	}
+
+	cmd, err := CreateKVMCommand("kvm", config, nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, argValue(cmd.Args, "-device"), "virtio-blk-device,drive=disk0,id=disk0-device")
+	assert.Contains(t, cmd.Args, "virtio-net-device,id=net0,netdev=net0")
+
+	config.NICs = []types.NIC{types.NICUser{Model: "e1000"}}
+	_, err = CreateKVMCommand("kvm", config, nil)
+	assert.NotNil(t, err)
+
+	config.NICs = nil
+	config.Disks = []types.Disk{{Path: "/images/data.raw", Interface: types.DiskInterfaceNVMe}}
+	_, err = CreateKVMCommand("kvm", config, nil)
+	assert.NotNil(t, err)
+
+	config.Disks = nil
+	config.Firmware = &types.Firmware{Code: "/usr/share/OVMF/OVMF_CODE.fd"}
+	_, err = CreateKVMCommand("kvm", config, nil)
+	assert.NotNil(t, err)
+}
+
+func TestCheckFirmware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	code := filepath.Join(dir, "OVMF_CODE.fd")
+	assert.Nil(t, ioutil.WriteFile(code, []byte{}, 0644))
+
+	assert.Nil(t, checkFirmware(types.VMConfig{
+		MachineType: "q35",
+		Firmware:    &types.Firmware{Code: code},
+	}, nil))
+
+	assert.NotNil(t, checkFirmware(types.VMConfig{
+		Firmware: &types.Firmware{Code: filepath.Join(dir, "missing")},
+	}, nil))
+
+	caps := &Capabilities{Version: Version{2, 8, 1}}
+	err = checkFirmware(types.VMConfig{
+		SMBIOS: &types.SMBIOS{OEMStrings: []string{"foo"}},
+	}, caps)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bytearena/schnapps/types"
+)
+
+var (
+	// Mount point of hugetlbfs
+	DEFAULT_HUGEPAGES_PATH = "/dev/hugepages"
+)
+
+func checkMemory(config types.VMConfig, caps *Capabilities) error {
+	if config.Balloon {
+		device := machineDevice(config.MachineType, "virtio-balloon-pci")
+
+		if !caps.HasDevice(device) {
+			return unsupported(caps, "device "+device)
+		}
+	}
+
+	memory := config.Memory
+
+	if memory == nil {
+		return nil
+	}
+
+	if path := memoryPath(memory); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("Could not back the memory: %v", err)
+		}
+	} else if memory.Shared && caps.Known() && !caps.Version.AtLeast(2, 12) {
+		return unsupported(caps, "shared memory without path")
+	}
+
+	// The memory backend can only be attached to a NUMA node
+	if config.MachineType == "microvm" && len(config.NUMANodes) == 0 && caps.Known() && !hasMachineMemoryBackend(caps) {
+		return unsupported(caps, "memory backend on microvm")
+	}
+
+	return nil
+}
+
+func memoryPath(memory *types.Memory) string {
+	if memory.HugePages && memory.Path == "" {
+		return DEFAULT_HUGEPAGES_PATH
+	}
+
+	return memory.Path
+}
+
+// -machine memory-backend appeared in QEMU 5.0
+func hasMachineMemoryBackend(caps *Capabilities) bool {
+	return caps.Known() && caps.Version.AtLeast(5, 0)
+}
+
+// The backend of the memory is attached to the machine if supported, to a
+// NUMA node otherwise. microvm has no NUMA nodes, a recent QEMU is assumed if
+// the capabilities are unknown.
+func machineMemoryBackend(config types.VMConfig, caps *Capabilities) bool {
+	if config.Memory == nil || len(config.NUMANodes) > 0 {
+		return false
+	}
+
+	if !caps.Known() {
+		return config.MachineType == "microvm"
+	}
+
+	return hasMachineMemoryBackend(caps)
+}
+
+// Memory backend object of the given size, in megabytes
+func memoryBackend(memory *types.Memory, id string, size int) string {
+	opts := []string{"id=" + id, "size=" + strconv.Itoa(size) + "M"}
+
+	if memory == nil {
+		return "memory-backend-ram," + strings.Join(opts, ",")
+	}
+
+	backend := "memory-backend-ram"
+
+	if path := memoryPath(memory); path != "" {
+		backend = "memory-backend-file"
+		opts = append(opts, "mem-path="+escapeOption(path))
+	} else if memory.Shared {
+		backend = "memory-backend-memfd"
+	}
+
+	if memory.Shared {
+		opts = append(opts, "share=on")
+	}
+
+	if memory.Prealloc {
+		opts = append(opts, "prealloc=on")
+	}
+
+	return backend + "," + strings.Join(opts, ",")
+}
+
+// Backend of the whole memory, the NUMA nodes have their own backends
+func buildMemoryArgs(config types.VMConfig, caps *Capabilities) []string {
+	if config.Memory == nil || len(config.NUMANodes) > 0 {
+		return []string{}
+	}
+
+	args := []string{"-object", memoryBackend(config.Memory, "mem", config.MegMemory)}
+
+	// Otherwise, see buildMachineArgs
+	if !machineMemoryBackend(config, caps) {
+		args = append(args, "-numa", "node,memdev=mem")
+	}
+
+	return args
+}
+
+func buildBalloonArgs(config types.VMConfig) []string {
+	if !config.Balloon {
+		return []string{}
+	}
+
+	return []string{"-device", machineDevice(config.MachineType, "virtio-balloon-pci") + ",id=balloon0"}
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBackend(t *testing.T) {
+	assert.Equal(t, memoryBackend(nil, "mem", 512), "memory-backend-ram,id=mem,size=512M")
+
+	assert.Equal(
+		t,
+		memoryBackend(&types.Memory{Prealloc: true}, "mem", 512),
+		"memory-backend-ram,id=mem,size=512M,prealloc=on",
+	)
+
+	assert.Equal(
+		t,
+		memoryBackend(&types.Memory{HugePages: true, Prealloc: true}, "mem0", 1024),
+		"memory-backend-file,id=mem0,size=1024M,mem-path=/dev/hugepages,prealloc=on",
+	)
+
+	assert.Equal(
+		t,
+		memoryBackend(&types.Memory{Path: "/dev/shm", Shared: true}, "mem", 512),
+		"memory-backend-file,id=mem,size=512M,mem-path=/dev/shm,share=on",
+	)
+
+	assert.Equal(
+		t,
+		memoryBackend(&types.Memory{Shared: true}, "mem", 512),
+		"memory-backend-memfd,id=mem,size=512M,share=on",
+	)
+}
+
+func TestCreateKVMCommandMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config := types.VMConfig{
+		MegMemory: 512,
+		Memory:    &types.Memory{Path: dir, Shared: true},
+		Balloon:   true,
+	}
+
+	// Legacy, through a NUMA node
+	cmd, err := CreateKVMCommand("kvm", config, nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, argValue(cmd.Args, "-object"), "memory-backend-file,id=mem,size=512M,mem-path="+dir+",share=on")
+	assert.Equal(t, argValue(cmd.Args, "-numa"), "node,memdev=mem")
+	assert.Contains(t, cmd.Args, "virtio-balloon-pci,id=balloon0")
+
+	caps := &Capabilities{
+		Version: Version{6, 2, 0},
+		devices: map[string]bool{"virtio-balloon-pci": true},
+	}
+
+	cmd, err = CreateKVMCommand("qemu-system-x86_64", config, caps)
+	require.Nil(t, err)
+
+	assert.Equal(t, argValue(cmd.Args, "-numa"), "")
+	assert.Equal(t, argValue(cmd.Args, "-machine"), "memory-backend=mem")
+
+	// NUMA nodes have their own backends
+	config.CPUAmount = 2
+	config.NUMANodes = []types.NUMANode{{CPUs: []int{0, 1}, MegMemory: 512}}
+
+	cmd, err = CreateKVMCommand("qemu-system-x86_64", config, caps)
+	assert.Nil(t, err)
+
+	assert.Equal(t, argValue(cmd.Args, "-object"), "memory-backend-file,id=mem0,size=512M,mem-path="+dir+",share=on")
+	assert.Equal(t, argValue(cmd.Args, "-machine"), "")
+}
+
+func TestCheckMemory(t *testing.T) {
+	caps := &Capabilities{
+		Version: Version{2, 8, 1},
+		devices: map[string]bool{"virtio-net-pci": true},
+	}
+
+	invalid := []types.VMConfig{
+		{Memory: &types.Memory{Path: "/missing"}},
+		{Memory: &types.Memory{Shared: true}},
+		{Memory: &types.Memory{}, MachineType: "microvm"},
+		{Balloon: true},
+	}
+
+	for i, config := range invalid {
+		assert.NotNil(t, checkMemory(config, caps), i)
+	}
+
+	err := checkMemory(types.VMConfig{Balloon: true}, caps)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	assert.Nil(t, checkMemory(types.VMConfig{Memory: &types.Memory{Prealloc: true}, Balloon: true}, nil))
+
+	// Unknown capabilities, the backend is attached to the machine
+	microvm := types.VMConfig{MegMemory: 512, Memory: &types.Memory{}, MachineType: "microvm"}
+
+	assert.Nil(t, checkMemory(microvm, nil))
+	assert.Nil(t, checkMemory(microvm, &Capabilities{}))
+
+	cmd, err := CreateKVMCommand("kvm", microvm, nil)
+	require.Nil(t, err)
+
+	assert.Equal(t, argValue(cmd.Args, "-numa"), "")
+	assert.Contains(t, argValue(cmd.Args, "-machine"), "memory-backend=mem")
+}
@@ -0,0 +1,144 @@
+package vm
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/bytearena/schnapps/console"
+	"github.com/bytearena/schnapps/logger"
+)
+
+// Last output of the serial console, up to Config.Console.BufferSize bytes.
+// Still available once the VM has exited, nil if it was never started.
+func (vm *VM) ConsoleTail() []byte {
+	if console := vm.getConsole(); console != nil {
+		return console.Tail()
+	}
+
+	return nil
+}
+
+// Streams the output of the serial console, preceded by the buffered output
+// if history is set. The reader returns io.EOF when the VM exits.
+func (vm *VM) ConsoleReader(history bool) (io.ReadCloser, error) {
+	console := vm.getConsole()
+
+	if console == nil {
+		return nil, errors.New("No console: the VM was not started")
+	}
+
+	return console.NewReader(history), nil
+}
+
+// Attaches an interactive session of the serial console to the connection,
+// starting with the buffered output. Blocks until the connection is closed
+// or the VM exits. Only one read-write session can be attached at a time,
+// see console.Mux.
+func (vm *VM) AttachConsole(conn io.ReadWriteCloser, readWrite bool) error {
+	mux := vm.getConsoleMux()
+
+	if mux == nil {
+		conn.Close()
+
+		return errors.New("No console: the VM is not running")
+	}
+
+	return mux.Attach(conn, readWrite)
+}
+
+// Serves the serial console over a websocket, see console.Mux.WebsocketHandler.
+// Only the origins of Console.AllowedOrigins can open sessions besides the
+// origin of the server.
+func (vm *VM) ConsoleHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux := vm.getConsoleMux()
+
+		if mux == nil {
+			http.Error(w, "No console: the VM is not running", http.StatusServiceUnavailable)
+			return
+		}
+
+		mux.WebsocketHandler(vm.Config.Console.AllowedOrigins...).ServeHTTP(w, r)
+	})
+}
+
+func (vm *VM) getConsole() *console.Console {
+	vm.consoleMutex.Lock()
+	defer vm.consoleMutex.Unlock()
+
+	return vm.console
+}
+
+func (vm *VM) getConsoleMux() *console.Mux {
+	vm.consoleMutex.Lock()
+	defer vm.consoleMutex.Unlock()
+
+	return vm.consoleMux
+}
+
+func (vm *VM) openConsole() error {
+	c, err := console.New(vm.Config.Console)
+
+	if err != nil {
+		return errors.New("Could not open the console: " + err.Error())
+	}
+
+	var listener net.Listener
+
+	if socket := vm.Config.Console.Socket; socket != "" {
+		listener, err = net.Listen("unix", socket)
+
+		if err != nil {
+			c.Close()
+
+			return errors.New("Could not open the console socket: " + err.Error())
+		}
+	}
+
+	vm.consoleMutex.Lock()
+	vm.console = c
+	vm.consoleListener = listener
+	vm.consoleMutex.Unlock()
+
+	return nil
+}
+
+// The input is the stdin of the process
+func (vm *VM) serveConsole(input io.Writer) {
+	vm.consoleMutex.Lock()
+	defer vm.consoleMutex.Unlock()
+
+	vm.consoleMux = console.NewMux(vm.console, input)
+
+	if listener := vm.consoleListener; listener != nil {
+		mux := vm.consoleMux
+
+		go func() {
+			if err := mux.Serve(listener); err != nil {
+				vm.log().Warn("Could not serve the console", logger.KEY_ERROR, err)
+			}
+		}()
+	}
+}
+
+func (vm *VM) closeConsole() {
+	vm.consoleMutex.Lock()
+	mux := vm.consoleMux
+	listener := vm.consoleListener
+	c := vm.console
+	vm.consoleMutex.Unlock()
+
+	if mux != nil {
+		mux.Close()
+	} else if listener != nil {
+		listener.Close()
+	}
+
+	if c != nil {
+		if err := c.Close(); err != nil {
+			vm.log().Warn("Could not close the console", logger.KEY_ERROR, err)
+		}
+	}
+}
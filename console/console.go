@@ -0,0 +1,224 @@
+// Package console captures the serial console of a VM: the last bytes are
+// kept in memory, optionally written to a rotating log file and streamed to
+// readers.
+package console
+
+import (
+	"io"
+	"sync"
+
+	"github.com/bytearena/schnapps/types"
+)
+
+var (
+	DEFAULT_BUFFER_SIZE   = 64 * 1024
+	DEFAULT_LOG_MAX_SIZE  = int64(10 * 1024 * 1024)
+	DEFAULT_LOG_MAX_FILES = 3
+)
+
+type Console struct {
+	ring       *Ring
+	log        *RotatingFile
+	bufferSize int
+
+	mutex   sync.Mutex
+	readers map[*reader]bool
+	closed  bool
+}
+
+func New(config types.Console) (*Console, error) {
+	c := &Console{
+		bufferSize: config.BufferSize,
+		readers:    make(map[*reader]bool),
+	}
+
+	if c.bufferSize <= 0 {
+		c.bufferSize = DEFAULT_BUFFER_SIZE
+	}
+
+	c.ring = NewRing(c.bufferSize)
+
+	if config.LogFile != "" {
+		maxSize := config.LogMaxSize
+
+		if maxSize <= 0 {
+			maxSize = DEFAULT_LOG_MAX_SIZE
+		}
+
+		maxFiles := config.LogMaxFiles
+
+		if maxFiles <= 0 {
+			maxFiles = DEFAULT_LOG_MAX_FILES
+		}
+
+		log, err := OpenRotatingFile(config.LogFile, maxSize, maxFiles)
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.log = log
+	}
+
+	return c, nil
+}
+
+// Never fails, the errors of the log file are ignored so that the console
+// is always drained.
+func (c *Console) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.ring.Write(p)
+
+	if c.closed {
+		return len(p), nil
+	}
+
+	if c.log != nil {
+		c.log.Write(p)
+	}
+
+	for r := range c.readers {
+		r.push(p)
+	}
+
+	return len(p), nil
+}
+
+// Last output of the console, up to the buffer size
+func (c *Console) Tail() []byte {
+	return c.ring.Bytes()
+}
+
+// Streams the output written from now on, preceded by the buffered output
+// if history is set. The reader returns io.EOF once the console is closed.
+// Slow readers lose their oldest pending output.
+func (c *Console) NewReader(history bool) io.ReadCloser {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	r := &reader{
+		console: c,
+		max:     c.bufferSize,
+		notify:  make(chan struct{}, 1),
+	}
+
+	if history {
+		r.pending = c.ring.Bytes()
+	}
+
+	if c.closed {
+		r.finish()
+	} else {
+		c.readers[r] = true
+	}
+
+	return r
+}
+
+// Closes the log file and ends the readers, the buffered output stays
+// available.
+func (c *Console) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return nil
+	}
+
+	c.closed = true
+
+	for r := range c.readers {
+		r.finish()
+	}
+
+	c.readers = nil
+
+	if c.log != nil {
+		return c.log.Close()
+	}
+
+	return nil
+}
+
+func (c *Console) remove(r *reader) {
+	c.mutex.Lock()
+	delete(c.readers, r)
+	c.mutex.Unlock()
+}
+
+type reader struct {
+	console *Console
+	max     int
+	notify  chan struct{}
+
+	mutex   sync.Mutex
+	pending []byte
+	done    bool
+}
+
+func (r *reader) push(p []byte) {
+	r.mutex.Lock()
+
+	r.pending = append(r.pending, p...)
+
+	if len(r.pending) > r.max {
+		r.pending = append([]byte{}, r.pending[len(r.pending)-r.max:]...)
+	}
+
+	r.mutex.Unlock()
+
+	r.wake()
+}
+
+// No more output, the pending output can still be read
+func (r *reader) finish() {
+	r.mutex.Lock()
+	r.done = true
+	r.mutex.Unlock()
+
+	r.wake()
+}
+
+func (r *reader) wake() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for {
+		r.mutex.Lock()
+
+		if len(r.pending) > 0 {
+			n := copy(p, r.pending)
+			r.pending = r.pending[n:]
+			r.mutex.Unlock()
+
+			return n, nil
+		}
+
+		done := r.done
+		r.mutex.Unlock()
+
+		if done {
+			return 0, io.EOF
+		}
+
+		<-r.notify
+	}
+}
+
+func (r *reader) Close() error {
+	r.console.remove(r)
+
+	r.mutex.Lock()
+	r.pending = nil
+	r.mutex.Unlock()
+
+	r.finish()
+
+	return nil
+}
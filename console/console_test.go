@@ -0,0 +1,146 @@
+package console
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(8)
+	assert.Equal(t, r.Bytes(), []byte{})
+
+	r.Write([]byte("abc"))
+	assert.Equal(t, string(r.Bytes()), "abc")
+
+	r.Write([]byte("defgh"))
+	assert.Equal(t, string(r.Bytes()), "abcdefgh")
+
+	r.Write([]byte("ij"))
+	assert.Equal(t, string(r.Bytes()), "cdefghij")
+
+	r.Write([]byte("0123456789"))
+	assert.Equal(t, string(r.Bytes()), "23456789")
+
+	r.Write([]byte("klm"))
+	assert.Equal(t, string(r.Bytes()), "56789klm")
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "console")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "console.log")
+
+	f, err := OpenRotatingFile(path, 4, 2)
+	require.Nil(t, err)
+
+	for _, chunk := range []string{"aa", "bb", "cc", "dd", "ee", "ff", "gg"} {
+		_, err := f.Write([]byte(chunk))
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, f.Close())
+
+	contents := map[string]string{
+		"console.log":   "gg",
+		"console.log.1": "eeff",
+		"console.log.2": "ccdd",
+	}
+
+	for name, expected := range contents {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.Nil(t, err)
+		assert.Equal(t, string(content), expected, name)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "console.log.3"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Appends to the existing file
+	f, err = OpenRotatingFile(path, 4, 2)
+	require.Nil(t, err)
+	f.Write([]byte("h"))
+	f.Close()
+
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), "ggh")
+}
+
+func TestConsoleReaders(t *testing.T) {
+	c, err := New(types.Console{BufferSize: 16})
+	require.Nil(t, err)
+
+	c.Write([]byte("Booting...\n"))
+
+	live := c.NewReader(false)
+	history := c.NewReader(true)
+	closed := c.NewReader(false)
+	assert.Nil(t, closed.Close())
+
+	c.Write([]byte("login: "))
+	assert.Nil(t, c.Close())
+
+	// Only kept in the buffer
+	c.Write([]byte("\n"))
+
+	out, err := ioutil.ReadAll(live)
+	assert.Nil(t, err)
+	assert.Equal(t, string(out), "login: ")
+
+	// Lost its oldest output, nothing was read
+	out, err = ioutil.ReadAll(history)
+	assert.Nil(t, err)
+	assert.Equal(t, string(out), "oting...\nlogin: ")
+
+	_, err = closed.Read(make([]byte, 1))
+	assert.Equal(t, err, io.EOF)
+
+	assert.Equal(t, string(c.Tail()), "ting...\nlogin: \n")
+
+	out, err = ioutil.ReadAll(c.NewReader(true))
+	assert.Nil(t, err)
+	assert.Equal(t, string(out), "ting...\nlogin: \n")
+}
+
+func TestConsoleSlowReader(t *testing.T) {
+	c, err := New(types.Console{BufferSize: 4})
+	require.Nil(t, err)
+
+	r := c.NewReader(false)
+	c.Write([]byte("abcdef"))
+	c.Close()
+
+	out, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, string(out), "cdef")
+}
+
+func TestConsoleLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "console")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "console.log")
+
+	c, err := New(types.Console{LogFile: path})
+	require.Nil(t, err)
+
+	c.Write([]byte("Welcome to LinuxKit\n"))
+	assert.Nil(t, c.Close())
+
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), "Welcome to LinuxKit\n")
+
+	_, err = New(types.Console{LogFile: filepath.Join(dir, "missing", "console.log")})
+	assert.NotNil(t, err)
+}
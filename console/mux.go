@@ -0,0 +1,220 @@
+package console
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+)
+
+var (
+	ErrBusy   = errors.New("The console already has a read-write session")
+	ErrClosed = errors.New("The console multiplexer is closed")
+
+	// Written to the clients of the socket attached read-only because of a
+	// read-write session
+	READ_ONLY_NOTICE = "[console in use, attached read-only]\r\n"
+)
+
+// Shares a console between sessions: any number of read-only viewers and a
+// single read-write session, whose input is written to the input of the
+// console. Each session starts with the buffered output.
+type Mux struct {
+	console *Console
+	input   io.Writer
+
+	mutex     sync.Mutex
+	writer    bool
+	sessions  map[io.Closer]bool
+	listeners map[net.Listener]bool
+	closed    bool
+}
+
+func NewMux(console *Console, input io.Writer) *Mux {
+	return &Mux{
+		console:   console,
+		input:     input,
+		sessions:  make(map[io.Closer]bool),
+		listeners: make(map[net.Listener]bool),
+	}
+}
+
+// Attaches a session to the connection and blocks until the connection or
+// the console is closed. The connection is closed on return. Returns ErrBusy
+// if a read-write session is requested while another one is attached.
+func (m *Mux) Attach(conn io.ReadWriteCloser, readWrite bool) error {
+	if readWrite && !m.acquireWriter() {
+		conn.Close()
+
+		return ErrBusy
+	}
+
+	return m.attach(conn, readWrite)
+}
+
+// The writer must be acquired for a read-write session
+func (m *Mux) attach(conn io.ReadWriteCloser, readWrite bool) error {
+	if readWrite {
+		defer m.releaseWriter()
+	}
+
+	if !m.addSession(conn) {
+		conn.Close()
+
+		return ErrClosed
+	}
+
+	defer m.removeSession(conn)
+
+	reader := m.console.NewReader(true)
+
+	output := make(chan struct{})
+
+	go func() {
+		io.Copy(conn, reader)
+		// The client is disconnected as well
+		conn.Close()
+		close(output)
+	}()
+
+	if readWrite {
+		io.Copy(m.input, conn)
+	} else {
+		io.Copy(ioutil.Discard, conn)
+	}
+
+	reader.Close()
+	<-output
+
+	return nil
+}
+
+// Serves the console to the clients of the listener, until it's closed. The
+// first client gets a read-write session, the next ones are attached
+// read-only while it's connected.
+func (m *Mux) Serve(listener net.Listener) error {
+	if !m.addListener(listener) {
+		listener.Close()
+
+		return ErrClosed
+	}
+
+	defer m.removeListener(listener)
+
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			if m.isClosed() {
+				return nil
+			}
+
+			return err
+		}
+
+		go func() {
+			readWrite := m.acquireWriter()
+
+			if !readWrite {
+				io.WriteString(conn, READ_ONLY_NOTICE)
+			}
+
+			m.attach(conn, readWrite)
+		}()
+	}
+}
+
+// Closes the listeners and the sessions
+func (m *Mux) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return nil
+	}
+
+	m.closed = true
+
+	for listener := range m.listeners {
+		listener.Close()
+	}
+
+	for session := range m.sessions {
+		session.Close()
+	}
+
+	return nil
+}
+
+// Whether a read-write session is attached
+func (m *Mux) HasWriter() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.writer
+}
+
+func (m *Mux) acquireWriter() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.writer || m.closed {
+		return false
+	}
+
+	m.writer = true
+
+	return true
+}
+
+func (m *Mux) releaseWriter() {
+	m.mutex.Lock()
+	m.writer = false
+	m.mutex.Unlock()
+}
+
+func (m *Mux) addSession(session io.Closer) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return false
+	}
+
+	m.sessions[session] = true
+
+	return true
+}
+
+func (m *Mux) removeSession(session io.Closer) {
+	m.mutex.Lock()
+	delete(m.sessions, session)
+	m.mutex.Unlock()
+}
+
+func (m *Mux) addListener(listener net.Listener) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return false
+	}
+
+	m.listeners[listener] = true
+
+	return true
+}
+
+func (m *Mux) removeListener(listener net.Listener) {
+	m.mutex.Lock()
+	delete(m.listeners, listener)
+	m.mutex.Unlock()
+}
+
+func (m *Mux) isClosed() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.closed
+}
@@ -0,0 +1,228 @@
+package console
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytearena/schnapps/types"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Console echoing its input, like a terminal
+func newEchoMux(t *testing.T) (*Console, *Mux) {
+	c, err := New(types.Console{})
+	require.Nil(t, err)
+
+	c.Write([]byte("login: "))
+
+	reader, writer := io.Pipe()
+
+	go func() {
+		io.Copy(c, reader)
+	}()
+
+	return c, NewMux(c, writer)
+}
+
+// Reads until the expected output, or fails after a second
+func expectOutput(t *testing.T, reader io.Reader, expected string) {
+	done := make(chan string, 1)
+
+	go func() {
+		out := make([]byte, len(expected))
+		io.ReadFull(reader, out)
+		done <- string(out)
+	}()
+
+	select {
+	case out := <-done:
+		assert.Equal(t, out, expected)
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for %q", expected)
+	}
+}
+
+func TestMuxAttach(t *testing.T) {
+	c, mux := newEchoMux(t)
+
+	writer, writerClient := net.Pipe()
+	viewer, viewerClient := net.Pipe()
+
+	attached := make(chan error, 2)
+
+	go func() {
+		attached <- mux.Attach(writer, true)
+	}()
+
+	expectOutput(t, writerClient, "login: ")
+	assert.True(t, mux.HasWriter())
+
+	busy, _ := net.Pipe()
+	assert.Equal(t, mux.Attach(busy, true), ErrBusy)
+
+	go func() {
+		attached <- mux.Attach(viewer, false)
+	}()
+
+	expectOutput(t, viewerClient, "login: ")
+
+	// The input of the viewer is ignored
+	viewerClient.Write([]byte("reboot\n"))
+	writerClient.Write([]byte("root\n"))
+
+	expectOutput(t, writerClient, "root\n")
+	expectOutput(t, viewerClient, "root\n")
+
+	writerClient.Close()
+	assert.Nil(t, <-attached)
+	assert.False(t, mux.HasWriter())
+
+	// Ends the remaining sessions
+	c.Close()
+	assert.Nil(t, <-attached)
+
+	_, err := viewerClient.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+
+	assert.Equal(t, string(c.Tail()), "login: root\n")
+}
+
+func TestMuxServe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "console")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	_, mux := newEchoMux(t)
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "console.sock"))
+	require.Nil(t, err)
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- mux.Serve(listener)
+	}()
+
+	writer, err := net.Dial("unix", listener.Addr().String())
+	require.Nil(t, err)
+	defer writer.Close()
+
+	expectOutput(t, writer, "login: ")
+
+	viewer, err := net.Dial("unix", listener.Addr().String())
+	require.Nil(t, err)
+	defer viewer.Close()
+
+	expectOutput(t, viewer, READ_ONLY_NOTICE+"login: ")
+
+	writer.Write([]byte("root\n"))
+	expectOutput(t, writer, "root\n")
+	expectOutput(t, viewer, "root\n")
+
+	assert.Nil(t, mux.Close())
+	assert.Nil(t, <-served)
+
+	// The sessions are closed
+	_, err = bufio.NewReader(writer).ReadString('\n')
+	assert.NotNil(t, err)
+
+	assert.Equal(t, mux.Attach(viewer, false), ErrClosed)
+}
+
+func TestMuxWebsocket(t *testing.T) {
+	c, mux := newEchoMux(t)
+
+	server := httptest.NewServer(mux.WebsocketHandler())
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	writer, _, err := websocket.DefaultDialer.Dial(url+"?mode=rw", nil)
+	require.Nil(t, err)
+	defer writer.Close()
+
+	viewer, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Nil(t, err)
+	defer viewer.Close()
+
+	for _, ws := range []*websocket.Conn{writer, viewer} {
+		_, msg, err := ws.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, string(msg), "login: ")
+	}
+
+	_, res, err := websocket.DefaultDialer.Dial(url+"?mode=rw", nil)
+	assert.NotNil(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, res.StatusCode, http.StatusConflict)
+
+	assert.Nil(t, writer.WriteMessage(websocket.TextMessage, []byte("root\n")))
+
+	_, msg, err := viewer.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, string(msg), "root\n")
+
+	c.Close()
+
+	_, _, err = viewer.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure))
+}
+
+func TestMuxWebsocketOrigin(t *testing.T) {
+	_, mux := newEchoMux(t)
+
+	dial := func(handler http.Handler, origin string) (*http.Response, error) {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		header := http.Header{}
+
+		if origin != "" {
+			header.Set("Origin", strings.Replace(origin, "<server>", server.URL, 1))
+		}
+
+		ws, res, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+
+		if err == nil {
+			ws.Close()
+		}
+
+		return res, err
+	}
+
+	// Same origin and non browser clients
+	_, err := dial(mux.WebsocketHandler(), "<server>")
+	assert.Nil(t, err)
+	_, err = dial(mux.WebsocketHandler(), "")
+	assert.Nil(t, err)
+
+	// Cross site
+	res, err := dial(mux.WebsocketHandler(), "https://evil.example.com")
+	assert.NotNil(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, res.StatusCode, http.StatusForbidden)
+
+	res, err = dial(mux.WebsocketHandler("https://dashboard.example.com"), "https://evil.example.com")
+	assert.NotNil(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, res.StatusCode, http.StatusForbidden)
+
+	// Opted in
+	_, err = dial(mux.WebsocketHandler("https://dashboard.example.com"), "https://dashboard.example.com")
+	assert.Nil(t, err)
+	_, err = dial(mux.WebsocketHandler("https://dashboard.example.com"), "<server>")
+	assert.Nil(t, err)
+	_, err = dial(mux.WebsocketHandler("*"), "https://evil.example.com")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,64 @@
+package console
+
+import (
+	"sync"
+)
+
+// Keeps the last bytes written to it
+type Ring struct {
+	mutex sync.Mutex
+	buf   []byte
+	// Next write position
+	pos  int
+	full bool
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{buf: make([]byte, size)}
+}
+
+func (r *Ring) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	n := len(p)
+	size := len(r.buf)
+
+	if size == 0 {
+		return n, nil
+	}
+
+	// Only the end fits
+	if len(p) >= size {
+		copy(r.buf, p[len(p)-size:])
+		r.pos = 0
+		r.full = true
+
+		return n, nil
+	}
+
+	copied := copy(r.buf[r.pos:], p)
+
+	if copied < len(p) {
+		copy(r.buf, p[copied:])
+		r.full = true
+	} else if r.pos+copied == size {
+		r.full = true
+	}
+
+	r.pos = (r.pos + len(p)) % size
+
+	return n, nil
+}
+
+// Copy of the content, oldest byte first
+func (r *Ring) Bytes() []byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.full {
+		return append([]byte{}, r.buf[:r.pos]...)
+	}
+
+	return append(append([]byte{}, r.buf[r.pos:]...), r.buf[:r.pos]...)
+}
@@ -0,0 +1,141 @@
+package console
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Serves the console over a websocket. The output is sent as binary
+// messages and the messages of a read-write session are written to the
+// input. Sessions are read-only unless requested with ?mode=rw, which fails
+// with 409 Conflict if another read-write session is attached.
+//
+// Browsers can only open sessions from the origin of the server, and from the
+// allowed origins (scheme://host[:port], "*" allows any origin). Requests
+// from another origin fail with 403 Forbidden.
+func (m *Mux) WebsocketHandler(allowedOrigins ...string) http.Handler {
+	upgrader := websocket.Upgrader{}
+
+	if len(allowedOrigins) > 0 {
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			return checkOrigin(r, allowedOrigins)
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readWrite := r.URL.Query().Get("mode") == "rw"
+
+		if readWrite && !m.acquireWriter() {
+			http.Error(w, ErrBusy.Error(), http.StatusConflict)
+			return
+		}
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+
+		if err != nil {
+			if readWrite {
+				m.releaseWriter()
+			}
+
+			// The upgrader has replied
+			return
+		}
+
+		m.attach(&websocketConn{ws: ws}, readWrite)
+	})
+}
+
+// Same origin check as the default of gorilla/websocket, plus the allowed
+// origins
+func checkOrigin(r *http.Request, allowedOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+
+	// Not a browser
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Stream over the messages of a websocket
+type websocketConn struct {
+	ws     *websocket.Conn
+	reader io.Reader
+
+	closeOnce sync.Once
+}
+
+func (c *websocketConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, reader, err := c.ws.NextReader()
+
+			if err != nil {
+				return 0, err
+			}
+
+			c.reader = reader
+		}
+
+		n, err := c.reader.Read(p)
+
+		if err == io.EOF {
+			c.reader = nil
+
+			if n == 0 {
+				continue
+			}
+
+			err = nil
+		}
+
+		return n, err
+	}
+}
+
+func (c *websocketConn) Write(p []byte) (int, error) {
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (c *websocketConn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		c.ws.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(time.Second),
+		)
+
+		err = c.ws.Close()
+	})
+
+	return err
+}
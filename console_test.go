@@ -0,0 +1,95 @@
+package vm
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytearena/schnapps/launcher/launchertest"
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsole(t *testing.T) {
+	l := &launchertest.Launcher{
+		Console: []string{"Booting kernel...", "Welcome to LinuxKit"},
+	}
+
+	vm := newFakeVM(t, types.VMConfig{
+		Boot: types.BootCheck{ConsoleMarker: "Welcome"},
+	}, l)
+
+	assert.Nil(t, vm.ConsoleTail())
+
+	_, err := vm.ConsoleReader(true)
+	assert.NotNil(t, err)
+
+	require.Nil(t, vm.Start())
+
+	reader, err := vm.ConsoleReader(true)
+	require.Nil(t, err)
+	defer reader.Close()
+
+	require.Nil(t, vm.WaitUntilBooted())
+	assert.Nil(t, l.Processes()[0].Print("login: root"))
+
+	assert.Nil(t, vm.Quit())
+	assert.Nil(t, vm.Wait())
+
+	// Ends with the VM
+	out, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, string(out), "Booting kernel...\nWelcome to LinuxKit\nlogin: root\n")
+
+	assert.Equal(t, string(vm.ConsoleTail()), "Booting kernel...\nWelcome to LinuxKit\nlogin: root\n")
+}
+
+func TestConsoleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vm")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "console.sock")
+
+	l := &launchertest.Launcher{Console: []string{"Welcome to LinuxKit"}}
+	vm := newFakeVM(t, types.VMConfig{
+		Console: types.Console{Socket: socket},
+	}, l)
+
+	notStarted, _ := net.Pipe()
+	assert.NotNil(t, vm.AttachConsole(notStarted, false))
+
+	require.Nil(t, vm.Start())
+
+	conn, err := net.Dial("unix", socket)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	line, err := reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, line, "Welcome to LinuxKit\n")
+
+	// Echoed by the fake guest
+	_, err = conn.Write([]byte("uname\n"))
+	assert.Nil(t, err)
+
+	line, err = reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, line, "uname\n")
+
+	assert.Nil(t, vm.Quit())
+	assert.Nil(t, vm.Wait())
+
+	// Ends with the VM
+	_, err = reader.ReadString('\n')
+	assert.NotNil(t, err)
+
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err))
+}
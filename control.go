@@ -0,0 +1,79 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	schnappsqmp "github.com/bytearena/schnapps/qmp"
+)
+
+// Run status as reported by QMP query-status
+type Status = schnappsqmp.StatusInfo
+
+// Freezes the guest vCPUs, the VM keeps its memory and devices.
+func (vm *VM) Pause(ctx context.Context) error {
+	if err := vm.checkTransition(StatePaused); err != nil {
+		return err
+	}
+
+	if err := vm.qmp.Stop(ctx); err != nil {
+		return err
+	}
+
+	return vm.setState(StatePaused)
+}
+
+// Resumes a paused guest.
+func (vm *VM) Resume(ctx context.Context) error {
+	if err := vm.checkTransition(StateRunning); err != nil {
+		return err
+	}
+
+	if err := vm.qmp.Cont(ctx); err != nil {
+		return err
+	}
+
+	return vm.setState(StateRunning)
+}
+
+// Resets the guest, as if the reset button was pressed. A paused VM stays
+// paused.
+func (vm *VM) Reset(ctx context.Context) error {
+	switch state := vm.State(); state {
+	case StateRunning, StatePaused, StateCrashed:
+	default:
+		return fmt.Errorf("Cannot reset VM in state %s", state)
+	}
+
+	return vm.qmp.SystemReset(ctx)
+}
+
+// Queries the run status from QEMU and reconciles the VM state with it.
+func (vm *VM) QueryStatus(ctx context.Context) (Status, error) {
+	status, err := vm.qmp.QueryStatus(ctx)
+
+	if err != nil {
+		return status, err
+	}
+
+	switch status.Status {
+	case "running":
+		vm.setState(StateRunning)
+	case "paused":
+		vm.setState(StatePaused)
+	case "guest-panicked":
+		vm.setState(StateCrashed)
+	}
+
+	return status, nil
+}
+
+func (vm *VM) checkTransition(to State) error {
+	from := vm.State()
+
+	if from != to && !canTransition(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+
+	return nil
+}
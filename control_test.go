@@ -0,0 +1,75 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bytearena/schnapps/libvirt"
+	"github.com/bytearena/schnapps/qmp/qmptest"
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlIllegalState(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+	ctx := context.Background()
+
+	assert.Equal(t, vm.Pause(ctx), &TransitionError{From: StateCreated, To: StatePaused})
+	assert.Equal(t, vm.Resume(ctx), &TransitionError{From: StateCreated, To: StateRunning})
+	assert.NotNil(t, vm.Reset(ctx))
+}
+
+func TestControlNotConnected(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+	vm.setState(StateStarting)
+	vm.setState(StateRunning)
+
+	assert.True(t, errors.Is(vm.Pause(context.Background()), ErrQMPNotConnected))
+	assert.Equal(t, vm.State(), StateRunning)
+
+	_, err := vm.QueryStatus(context.Background())
+	assert.True(t, errors.Is(err, ErrQMPNotConnected))
+}
+
+func TestControlQMP(t *testing.T) {
+	server, err := qmptest.NewServer()
+	require.Nil(t, err)
+	defer server.Close()
+
+	vm := NewVM(types.VMConfig{})
+	vm.Config.QMPServer = server.Config()
+	vm.setState(StateStarting)
+
+	ctx := context.Background()
+
+	require.Nil(t, vm.connect(ctx))
+	defer vm.Close()
+
+	vm.setState(StateRunning)
+
+	events, cancel := vm.Subscribe(libvirt.EVENT_STOP, libvirt.EVENT_RESUME)
+	defer cancel()
+
+	assert.Nil(t, vm.Pause(ctx))
+	assert.Equal(t, vm.State(), StatePaused)
+	assert.Equal(t, (<-events).Name, libvirt.EVENT_STOP)
+
+	status, err := vm.QueryStatus(ctx)
+	assert.Nil(t, err)
+	assert.False(t, status.Running)
+
+	assert.Nil(t, vm.Resume(ctx))
+	assert.Equal(t, vm.State(), StateRunning)
+	assert.Equal(t, (<-events).Name, libvirt.EVENT_RESUME)
+
+	assert.Nil(t, vm.Reset(ctx))
+
+	commands := []string{}
+	for _, cmd := range server.Commands() {
+		commands = append(commands, cmd.Execute)
+	}
+
+	assert.Equal(t, commands, []string{"stop", "query-status", "cont", "system_reset"})
+}
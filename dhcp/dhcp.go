@@ -4,6 +4,8 @@ import (
 	"errors"
 	"math"
 	"net"
+
+	"github.com/bytearena/schnapps/logger"
 )
 
 type DHCPServer struct {
@@ -12,6 +14,8 @@ type DHCPServer struct {
 	Current        int
 	Used           map[string]bool
 	Max            int
+
+	log logger.Logger
 }
 
 func NewDHCPServer(cidr string) (*DHCPServer, error) {
@@ -38,14 +42,22 @@ func NewDHCPServer(cidr string) (*DHCPServer, error) {
 	}, nil
 }
 
+// logger.Default() is used if no logger is set
+func (dhcp *DHCPServer) SetLogger(l logger.Logger) {
+	dhcp.log = l
+}
+
 func (dhcp *DHCPServer) Pop() (string, error) {
 	for i := 0; i < dhcp.Max; i++ {
 		next := dhcp.NextIP()
 		if !dhcp.Used[next] {
 			dhcp.Used[next] = true
+			logger.OrDefault(dhcp.log).Debug("Leased IP", "ip", next)
 			return next, nil
 		}
 	}
+
+	logger.OrDefault(dhcp.log).Warn("No IP left", "network", dhcp.NetworkAddress.String())
 	return "", errors.New("No ip left")
 }
 
@@ -67,5 +79,6 @@ func (dhcp *DHCPServer) NextIP() string {
 }
 
 func (dhcp *DHCPServer) Release(ip string) {
+	logger.OrDefault(dhcp.log).Debug("Released IP", "ip", ip)
 	delete(dhcp.Used, ip)
 }
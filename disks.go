@@ -0,0 +1,118 @@
+package vm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bytearena/schnapps/image"
+	"github.com/bytearena/schnapps/logger"
+	"github.com/bytearena/schnapps/types"
+)
+
+// Directory holding the files of the VM (disk overlays, …), empty until the
+// VM is started
+func (vm *VM) WorkDir() string {
+	return vm.workDir
+}
+
+// Returns the config to launch, with the overlay disks replaced by their
+// overlay.
+func (vm *VM) prepareDisks(config types.VMConfig) (types.VMConfig, error) {
+	disks := make([]types.Disk, len(config.Disks))
+
+	for i, disk := range config.Disks {
+		if disk.Persistence != types.DiskOverlay {
+			disks[i] = disk
+			continue
+		}
+
+		overlay, err := vm.createOverlay("disk"+strconv.Itoa(i), disk)
+
+		if err != nil {
+			return config, err
+		}
+
+		disk.Path = overlay
+		disk.Format = types.DiskFormatQCOW2
+		disk.Persistence = types.DiskPersistent
+		disks[i] = disk
+	}
+
+	config.Disks = disks
+
+	return config, nil
+}
+
+// The overlays are stored by the image manager of the config if any, in a
+// temporary work directory otherwise.
+func (vm *VM) createOverlay(name string, disk types.Disk) (string, error) {
+	if err := vm.createWorkDir(); err != nil {
+		return "", err
+	}
+
+	if images := vm.Config.Images; images != nil {
+		return images.Create(vm.Config.Id, name, disk.Path, string(disk.Format))
+	}
+
+	overlay := filepath.Join(vm.workDir, name+".qcow2")
+
+	return overlay, image.CreateOverlay(disk.Path, string(disk.Format), overlay)
+}
+
+func (vm *VM) createWorkDir() error {
+	if vm.workDir != "" {
+		return nil
+	}
+
+	if images := vm.Config.Images; images != nil {
+		dir, err := images.Open(vm.Config.Id)
+
+		if err != nil {
+			return fmt.Errorf("Could not create the work directory: %v", err)
+		}
+
+		vm.workDir = dir
+
+		return nil
+	}
+
+	dir, err := ioutil.TempDir(vm.Config.WorkDir, "vm-"+strconv.Itoa(vm.Config.Id)+"-")
+
+	if err != nil {
+		return fmt.Errorf("Could not create the work directory: %v", err)
+	}
+
+	vm.workDir = dir
+
+	return nil
+}
+
+func (vm *VM) removeWorkDir() {
+	if vm.workDir == "" {
+		return
+	}
+
+	var err error
+
+	if images := vm.Config.Images; images != nil {
+		// Moved aside, the next VM with the same id gets a new directory
+		if vm.Config.RetainWorkDir {
+			var retained string
+
+			if retained, err = images.Retain(vm.Config.Id); err == nil {
+				vm.workDir = retained
+			}
+		} else {
+			err = images.Remove(vm.Config.Id)
+		}
+	} else if !vm.Config.RetainWorkDir {
+		err = os.RemoveAll(vm.workDir)
+	}
+
+	if err != nil {
+		vm.log().Warn("Could not remove the work directory", logger.KEY_ERROR, err)
+	}
+}
@@ -0,0 +1,198 @@
+package vm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytearena/schnapps/image"
+	"github.com/bytearena/schnapps/image/imagetest"
+	"github.com/bytearena/schnapps/launcher/launchertest"
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlayDisks(t *testing.T) {
+	dir, restore, err := imagetest.FakeQemuImg(&image.QEMU_IMG)
+	require.Nil(t, err)
+	defer restore()
+
+	l := &launchertest.Launcher{}
+	vm := newFakeVM(t, types.VMConfig{
+		WorkDir: dir,
+		Disks: []types.Disk{
+			{Path: "/images/assets.raw", ReadOnly: true},
+			{Path: "/images/linuxkit.qcow2", Format: types.DiskFormatQCOW2, Persistence: types.DiskOverlay},
+		},
+	}, l)
+
+	require.Nil(t, vm.Start())
+
+	overlay := filepath.Join(vm.WorkDir(), "disk1.qcow2")
+	assert.FileExists(t, overlay)
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(args), "create -f qcow2 -b /images/linuxkit.qcow2 -F qcow2 "+overlay+"\n")
+
+	// The launched disk is the overlay, the config is left untouched
+	disks := l.Processes()[0].Config.Disks
+	assert.Equal(t, disks[0], vm.Config.Disks[0])
+	assert.Equal(t, disks[1], types.Disk{
+		Path:        overlay,
+		Format:      types.DiskFormatQCOW2,
+		Persistence: types.DiskPersistent,
+	})
+	assert.Equal(t, vm.Config.Disks[1].Path, "/images/linuxkit.qcow2")
+
+	assert.Nil(t, vm.Quit())
+	assert.Nil(t, vm.Wait())
+
+	_, err = os.Stat(vm.WorkDir())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOverlayDisksRetained(t *testing.T) {
+	dir, restore, err := imagetest.FakeQemuImg(&image.QEMU_IMG)
+	require.Nil(t, err)
+	defer restore()
+
+	vm := newFakeVM(t, types.VMConfig{
+		WorkDir:       dir,
+		RetainWorkDir: true,
+		Disks: []types.Disk{
+			{Path: "/images/linuxkit.raw", Persistence: types.DiskOverlay},
+		},
+	}, &launchertest.Launcher{})
+
+	require.Nil(t, vm.Start())
+	assert.Nil(t, vm.Quit())
+	assert.Nil(t, vm.Wait())
+
+	assert.FileExists(t, filepath.Join(vm.WorkDir(), "disk0.qcow2"))
+}
+
+func TestOverlayDisksError(t *testing.T) {
+	dir, restore, err := imagetest.FakeQemuImg(&image.QEMU_IMG)
+	require.Nil(t, err)
+	defer restore()
+
+	image.QEMU_IMG = filepath.Join(dir, "missing")
+
+	vm := newFakeVM(t, types.VMConfig{
+		WorkDir: dir,
+		Disks: []types.Disk{
+			{Path: "/images/linuxkit.raw", Persistence: types.DiskOverlay},
+		},
+	}, &launchertest.Launcher{})
+
+	assert.NotNil(t, vm.Start())
+	assert.Equal(t, vm.State(), StateStopped)
+
+	// The work directory is removed
+	_, err = os.Stat(vm.WorkDir())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOverlayDisksImageManager(t *testing.T) {
+	dir, restore, err := imagetest.FakeQemuImg(&image.QEMU_IMG)
+	require.Nil(t, err)
+	defer restore()
+
+	images, err := image.NewManager(filepath.Join(dir, "overlays"))
+	require.Nil(t, err)
+
+	vm := newFakeVM(t, types.VMConfig{
+		Id:     7,
+		Images: images,
+		Disks: []types.Disk{
+			{Path: "/images/linuxkit.raw", Persistence: types.DiskOverlay},
+		},
+	}, &launchertest.Launcher{})
+
+	require.Nil(t, vm.Start())
+
+	assert.Equal(t, vm.WorkDir(), images.Dir(7))
+	assert.Equal(t, images.Overlays(7), []string{filepath.Join(images.Dir(7), "disk0.qcow2")})
+
+	assert.Nil(t, vm.Quit())
+	assert.Nil(t, vm.Wait())
+
+	assert.Equal(t, images.VMs(), []int{})
+}
+
+func TestOverlayDisksImageManagerRetained(t *testing.T) {
+	dir, restore, err := imagetest.FakeQemuImg(&image.QEMU_IMG)
+	require.Nil(t, err)
+	defer restore()
+
+	images, err := image.NewManager(filepath.Join(dir, "overlays"))
+	require.Nil(t, err)
+
+	config := types.VMConfig{
+		Id:            7,
+		Images:        images,
+		RetainWorkDir: true,
+		Disks: []types.Disk{
+			{Path: "/images/linuxkit.raw", Persistence: types.DiskOverlay},
+		},
+	}
+
+	first := newFakeVM(t, config, &launchertest.Launcher{})
+
+	require.Nil(t, first.Start())
+	assert.Nil(t, first.Quit())
+	assert.Nil(t, first.Wait())
+
+	// Moved aside
+	retained := first.WorkDir()
+	assert.NotEqual(t, retained, images.Dir(7))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(retained, "disk0.qcow2"), []byte("crash"), 0644))
+
+	removed, err := images.GC()
+	assert.Nil(t, err)
+	assert.Equal(t, removed, []int{})
+
+	// The daemon restarted, ids start over
+	config.RetainWorkDir = false
+	second := newFakeVM(t, config, &launchertest.Launcher{})
+
+	require.Nil(t, second.Start())
+	assert.Equal(t, second.WorkDir(), images.Dir(7))
+	assert.Nil(t, second.Quit())
+	assert.Nil(t, second.Wait())
+
+	content, err := ioutil.ReadFile(filepath.Join(retained, "disk0.qcow2"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), "crash")
+}
+
+func TestWorkDirImageManagerWithoutOverlays(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disks")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	images, err := image.NewManager(dir)
+	require.Nil(t, err)
+
+	vm := newFakeVM(t, types.VMConfig{
+		Id:     7,
+		Images: images,
+	}, &launchertest.Launcher{})
+
+	require.Nil(t, vm.Start())
+
+	// The guest agent socket lives in the work directory of the running VM
+	removed, err := images.GC()
+	assert.Nil(t, err)
+	assert.Equal(t, removed, []int{})
+	assert.DirExists(t, vm.WorkDir())
+
+	assert.Nil(t, vm.Quit())
+	assert.Nil(t, vm.Wait())
+
+	_, err = os.Stat(vm.WorkDir())
+	assert.True(t, os.IsNotExist(err))
+}
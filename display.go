@@ -0,0 +1,107 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/bytearena/schnapps/cli"
+	"github.com/bytearena/schnapps/display"
+	"github.com/bytearena/schnapps/types"
+)
+
+// Address of the VNC or SPICE server, a *net.TCPAddr or a *net.UnixAddr.
+// Nil if the VM has no display or is not running.
+func (vm *VM) DisplayAddr() net.Addr {
+	vm.displayMutex.Lock()
+	defer vm.displayMutex.Unlock()
+
+	return vm.displayAddr
+}
+
+// Allocates the port of the display
+func (vm *VM) prepareDisplay(config types.VMConfig) (types.VMConfig, error) {
+	if config.Display == nil {
+		return config, nil
+	}
+
+	d := *config.Display
+
+	if d.Addr == "" {
+		d.Addr = cli.DEFAULT_DISPLAY_ADDR
+	}
+
+	var addr net.Addr
+
+	if d.Socket != "" {
+		addr = &net.UnixAddr{Net: "unix", Name: d.Socket}
+	} else {
+		if d.Port == 0 {
+			port, err := display.AllocatePort(d.Addr)
+
+			if err != nil {
+				return config, fmt.Errorf("Could not allocate the display port: %w", err)
+			}
+
+			d.Port = port
+
+			vm.displayMutex.Lock()
+			vm.displayPort = port
+			vm.displayMutex.Unlock()
+		}
+
+		tcpAddr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(d.Addr, strconv.Itoa(d.Port)))
+
+		if err != nil {
+			vm.releaseDisplay()
+
+			return config, fmt.Errorf("Invalid display address: %v", err)
+		}
+
+		addr = tcpAddr
+	}
+
+	vm.displayMutex.Lock()
+	vm.displayAddr = addr
+	vm.displayMutex.Unlock()
+
+	config.Display = &d
+
+	return config, nil
+}
+
+func (vm *VM) releaseDisplay() {
+	vm.displayMutex.Lock()
+	defer vm.displayMutex.Unlock()
+
+	vm.displayAddr = nil
+
+	if vm.displayPort != 0 {
+		display.ReleasePort(vm.displayPort)
+		vm.displayPort = 0
+	}
+}
+
+func (vm *VM) setDisplayPassword(ctx context.Context) error {
+	d := vm.Config.Display
+
+	if d == nil || d.Password == "" {
+		return nil
+	}
+
+	var err error
+
+	switch d.Protocol {
+	case types.DisplayVNC:
+		err = vm.qmp.ChangeVNCPassword(ctx, d.Password)
+	case types.DisplaySPICE:
+		err = vm.qmp.SetPassword(ctx, string(d.Protocol), d.Password)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Could not set the display password: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+// Package display allocates the TCP ports of the VNC and SPICE servers of the
+// VMs.
+package display
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+)
+
+var (
+	// VNC display 0
+	START = 5900
+
+	// Only MAX displays can be served at the same time
+	MAX = 99
+
+	ErrNoPortLeft = errors.New("No display port left")
+
+	mutex sync.Mutex
+	used  = make(map[int]bool)
+)
+
+// Reserves the first port from START that is neither reserved nor in use on
+// the host. It must be released with ReleasePort.
+func AllocatePort(host string) (int, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for port := START; port <= START+MAX; port++ {
+		if used[port] || !isFree(host, port) {
+			continue
+		}
+
+		used[port] = true
+
+		return port, nil
+	}
+
+	return 0, ErrNoPortLeft
+}
+
+func ReleasePort(port int) {
+	mutex.Lock()
+	delete(used, port)
+	mutex.Unlock()
+}
+
+func isFree(host string, port int) bool {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+
+	if err != nil {
+		return false
+	}
+
+	listener.Close()
+
+	return true
+}
@@ -0,0 +1,41 @@
+package display
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocatePort(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer busy.Close()
+
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+
+	previousStart, previousMax := START, MAX
+	defer func() {
+		START, MAX = previousStart, previousMax
+	}()
+
+	// The busy port, then the next one
+	START, MAX = busyPort, 1
+
+	port, err := AllocatePort("127.0.0.1")
+	require.Nil(t, err, strconv.Itoa(busyPort))
+	assert.Equal(t, port, busyPort+1)
+
+	_, err = AllocatePort("127.0.0.1")
+	assert.Equal(t, err, ErrNoPortLeft)
+
+	ReleasePort(port)
+
+	again, err := AllocatePort("127.0.0.1")
+	assert.Nil(t, err)
+	assert.Equal(t, again, port)
+
+	ReleasePort(again)
+}
@@ -0,0 +1,57 @@
+package vm
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/bytearena/schnapps/launcher/launchertest"
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisplay(t *testing.T) {
+	l := &launchertest.Launcher{}
+	vm := newFakeVM(t, types.VMConfig{
+		Display: &types.Display{Protocol: types.DisplayVNC, Password: "secret"},
+	}, l)
+
+	assert.Nil(t, vm.DisplayAddr())
+
+	require.Nil(t, vm.Start())
+
+	addr, ok := vm.DisplayAddr().(*net.TCPAddr)
+	require.True(t, ok)
+	assert.Equal(t, addr.IP.String(), "127.0.0.1")
+	assert.True(t, addr.Port >= 5900)
+
+	process := l.Processes()[0]
+	assert.Equal(t, process.Config.Display.Port, addr.Port)
+
+	var password json.RawMessage
+
+	for _, cmd := range process.QMP().Commands() {
+		if cmd.Execute == "change-vnc-password" {
+			password = cmd.Arguments
+		}
+	}
+
+	assert.JSONEq(t, string(password), `{"password": "secret"}`)
+
+	assert.Nil(t, vm.Quit())
+	assert.Nil(t, vm.Wait())
+
+	assert.Nil(t, vm.DisplayAddr())
+}
+
+func TestDisplaySocket(t *testing.T) {
+	vm := newFakeVM(t, types.VMConfig{
+		Display: &types.Display{Protocol: types.DisplaySPICE, Socket: "/run/vm-1.sock"},
+	}, &launchertest.Launcher{})
+
+	require.Nil(t, vm.Start())
+	defer vm.Quit()
+
+	assert.Equal(t, vm.DisplayAddr(), &net.UnixAddr{Net: "unix", Name: "/run/vm-1.sock"})
+}
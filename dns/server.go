@@ -3,6 +3,7 @@ package dns
 import (
 	"fmt"
 
+	"github.com/bytearena/schnapps/logger"
 	"github.com/miekg/dns"
 )
 
@@ -14,6 +15,7 @@ type Server struct {
 	zone          string
 	records       Records
 	onRequestHook onRequestHook
+	log           logger.Logger
 
 	stopChan chan bool
 }
@@ -36,6 +38,11 @@ func (s *Server) SetOnRequestHook(fn onRequestHook) {
 	s.onRequestHook = fn
 }
 
+// logger.Default() is used if no logger is set. Must be called before Start.
+func (s *Server) SetLogger(l logger.Logger) {
+	s.log = l
+}
+
 // Start the DNS server
 func (s *Server) Start() error {
 	dns.HandleFunc(s.zone, s.handleDnsRequest)
@@ -45,9 +52,12 @@ func (s *Server) Start() error {
 		Net:  "udp",
 	}
 
+	logger.OrDefault(s.log).Info("Starting DNS server", "addr", s.addr, "zone", s.zone)
+
 	err := server.ListenAndServe()
 
 	if err != nil {
+		logger.OrDefault(s.log).Error("DNS server failed", logger.KEY_ERROR, err)
 		return err
 	}
 
@@ -68,6 +78,8 @@ func (s *Server) parseQuery(m *dns.Msg) {
 			s.onRequestHook(q.Name)
 
 			ip := s.records[q.Name]
+			logger.OrDefault(s.log).Debug("DNS query", "name", q.Name, "answer", ip)
+
 			if ip != "" {
 				rr, err := dns.NewRR(fmt.Sprintf("%s A %s", q.Name, ip))
 				if err == nil {
@@ -0,0 +1,35 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bytearena/schnapps/cli"
+	"github.com/bytearena/schnapps/launcher"
+	schnappsqmp "github.com/bytearena/schnapps/qmp"
+)
+
+// The errors returned by the VM wrap one of these, use errors.Is to match
+// them.
+var (
+	ErrKVMNotFound     = launcher.ErrKVMNotFound
+	ErrKVMUnavailable  = launcher.ErrKVMUnavailable
+	ErrProcessStart    = launcher.ErrProcessStart
+	ErrUnsupported     = cli.ErrUnsupported
+	ErrProcessExited   = errors.New("KVM process exited")
+	ErrQMPConnect      = errors.New("Could not connect to the QMP server")
+	ErrQMPNotConnected = schnappsqmp.ErrNotConnected
+)
+
+func wrapError(kind error, err error) error {
+	return fmt.Errorf("%w: %v", kind, err)
+}
+
+// Sent on the VM's ExitStatus channel once the KVM process has exited.
+type ExitStatus struct {
+	// -1 if the process was terminated by a signal
+	Code int
+
+	// nil if the process exited cleanly, wraps ErrProcessExited otherwise
+	Err error
+}
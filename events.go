@@ -0,0 +1,154 @@
+package vm
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/bytearena/schnapps/logger"
+	"github.com/digitalocean/go-qemu/qmp"
+)
+
+var (
+	EVENT_SUBSCRIBER_BUFFER_SIZE = 64
+)
+
+// QMP event emitted by the VM, see the libvirt package for the names.
+type Event struct {
+	Name      string
+	Data      map[string]interface{}
+	Timestamp time.Time
+}
+
+// Decodes the event's data into one of the *EventData types (or any struct
+// matching the QMP payload).
+func (e Event) Decode(v interface{}) error {
+	buf, err := json.Marshal(e.Data)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buf, v)
+}
+
+// Payload of SHUTDOWN and RESET
+type ShutdownEventData struct {
+	Guest  bool   `json:"guest"`
+	Reason string `json:"reason"`
+}
+
+// Payload of GUEST_PANICKED
+type GuestPanickedEventData struct {
+	Action string `json:"action"`
+}
+
+// Payload of BLOCK_IO_ERROR
+type BlockIOErrorEventData struct {
+	Device    string `json:"device"`
+	NodeName  string `json:"node-name"`
+	Operation string `json:"operation"`
+	Action    string `json:"action"`
+	NoSpace   bool   `json:"nospace"`
+	Reason    string `json:"reason"`
+}
+
+// Payload of DEVICE_DELETED
+type DeviceDeletedEventData struct {
+	Device string `json:"device"`
+	Path   string `json:"path"`
+}
+
+type eventSubscriber struct {
+	ch     chan Event
+	filter map[string]bool
+}
+
+func newEvent(e qmp.Event) Event {
+	return Event{
+		Name: e.Event,
+		Data: e.Data,
+		Timestamp: time.Unix(
+			e.Timestamp.Seconds,
+			e.Timestamp.Microseconds*int64(time.Microsecond),
+		),
+	}
+}
+
+// Returns a channel receiving the QMP events whose name is in the filter, or
+// every event if the filter is empty. Slow subscribers miss events once their
+// buffer is full. The channel is closed once the KVM process has exited or
+// when the cancel function is called, right away if the process has already
+// exited.
+func (vm *VM) Subscribe(filter ...string) (<-chan Event, func()) {
+	sub := &eventSubscriber{
+		ch:     make(chan Event, EVENT_SUBSCRIBER_BUFFER_SIZE),
+		filter: make(map[string]bool),
+	}
+
+	for _, name := range filter {
+		sub.filter[name] = true
+	}
+
+	vm.eventMutex.Lock()
+	defer vm.eventMutex.Unlock()
+
+	if vm.eventClosed {
+		close(sub.ch)
+
+		return sub.ch, func() {}
+	}
+
+	if vm.eventSubscribers == nil {
+		vm.eventSubscribers = make(map[*eventSubscriber]bool)
+	}
+	vm.eventSubscribers[sub] = true
+
+	cancel := func() {
+		vm.eventMutex.Lock()
+		defer vm.eventMutex.Unlock()
+
+		if vm.eventSubscribers[sub] {
+			delete(vm.eventSubscribers, sub)
+			close(sub.ch)
+		}
+	}
+
+	return sub.ch, cancel
+}
+
+func (vm *VM) handleEvent(e qmp.Event) {
+	event := newEvent(e)
+
+	vm.log().Debug("Received event", logger.KEY_EVENT, event.Name)
+
+	vm.updateStateFromEvent(event)
+	vm.publishEvent(event)
+}
+
+func (vm *VM) publishEvent(e Event) {
+	vm.eventMutex.Lock()
+	defer vm.eventMutex.Unlock()
+
+	for sub := range vm.eventSubscribers {
+		if len(sub.filter) > 0 && !sub.filter[e.Name] {
+			continue
+		}
+
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+}
+
+func (vm *VM) closeEventSubscribers() {
+	vm.eventMutex.Lock()
+	defer vm.eventMutex.Unlock()
+
+	vm.eventClosed = true
+
+	for sub := range vm.eventSubscribers {
+		delete(vm.eventSubscribers, sub)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,64 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/bytearena/schnapps/libvirt"
+	"github.com/bytearena/schnapps/types"
+	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+
+	all, cancelAll := vm.Subscribe()
+	defer cancelAll()
+
+	deleted, cancelDeleted := vm.Subscribe(libvirt.EVENT_DEVICE_DELETED)
+	defer cancelDeleted()
+
+	vm.handleEvent(qmp.Event{Event: libvirt.EVENT_POWERDOWN})
+	vm.handleEvent(qmp.Event{
+		Event: libvirt.EVENT_DEVICE_DELETED,
+		Data:  map[string]interface{}{"device": "net1", "path": "/machine/peripheral/net1"},
+	})
+
+	assert.Equal(t, (<-all).Name, libvirt.EVENT_POWERDOWN)
+	assert.Equal(t, (<-all).Name, libvirt.EVENT_DEVICE_DELETED)
+
+	e := <-deleted
+	assert.Equal(t, e.Name, libvirt.EVENT_DEVICE_DELETED)
+
+	var data DeviceDeletedEventData
+	assert.Nil(t, e.Decode(&data))
+	assert.Equal(t, data.Device, "net1")
+
+	assert.Len(t, deleted, 0)
+}
+
+func TestSubscribeBoundedBuffer(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+
+	events, cancel := vm.Subscribe()
+
+	for i := 0; i < EVENT_SUBSCRIBER_BUFFER_SIZE+1; i++ {
+		vm.handleEvent(qmp.Event{Event: libvirt.EVENT_RTC_CHANGE})
+	}
+
+	assert.Len(t, events, EVENT_SUBSCRIBER_BUFFER_SIZE)
+
+	cancel()
+	cancel()
+}
+
+func TestSubscribeAfterExit(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+	vm.closeEventSubscribers()
+
+	events, cancel := vm.Subscribe()
+	defer cancel()
+
+	_, ok := <-events
+	assert.False(t, ok)
+}
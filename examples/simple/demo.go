@@ -18,6 +18,7 @@ const (
 	BRIDGE_NAME           = "brtest"
 	CIDR                  = "10.1.0.1/24"
 	VM_RAW_IMAGE_LOCATION = "./linuxkit/linuxkit.raw"
+	BOOT_CONSOLE_MARKER   = "Welcome to LinuxKit"
 )
 
 func main() {
@@ -55,7 +56,7 @@ func SpawnWorker(id int) (*vm.VM, error) {
 	mac := vmid.GenerateRandomMAC()
 
 	config := vmtypes.VMConfig{
-		NICs: []interface{}{
+		NICs: []vmtypes.NIC{
 			vmtypes.NICBridge{
 				Bridge: BRIDGE_NAME,
 				MAC:    mac,
@@ -67,6 +68,9 @@ func SpawnWorker(id int) (*vm.VM, error) {
 		CPUCoreAmount: CPU_CORE_AMOUNT,
 		ImageLocation: VM_RAW_IMAGE_LOCATION,
 		Metadata:      vmtypes.VMMetadata{},
+		Boot: vmtypes.BootCheck{
+			ConsoleMarker: BOOT_CONSOLE_MARKER,
+		},
 	}
 
 	workerVm := vm.NewVM(config)
@@ -0,0 +1,57 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bytearena/schnapps/types"
+)
+
+// Returns the config to launch, with the UEFI variable store replaced by a
+// copy in the work directory. The guest writes its boot entries to it.
+func (vm *VM) prepareFirmware(config types.VMConfig) (types.VMConfig, error) {
+	if config.Firmware == nil || config.Firmware.Vars == "" {
+		return config, nil
+	}
+
+	if err := vm.createWorkDir(); err != nil {
+		return config, err
+	}
+
+	vars := filepath.Join(vm.workDir, "OVMF_VARS.fd")
+
+	if err := copyFile(config.Firmware.Vars, vars); err != nil {
+		return config, fmt.Errorf("Could not copy the UEFI variable store: %v", err)
+	}
+
+	firmware := *config.Firmware
+	firmware.Vars = vars
+	config.Firmware = &firmware
+
+	return config, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,48 @@
+package vm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytearena/schnapps/launcher/launchertest"
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirmwareVarsCopy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "firmware")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	template := filepath.Join(dir, "OVMF_VARS.fd")
+	require.Nil(t, ioutil.WriteFile(template, []byte("vars"), 0644))
+
+	l := &launchertest.Launcher{}
+	vm := newFakeVM(t, types.VMConfig{
+		WorkDir: dir,
+		Firmware: &types.Firmware{
+			Code: "/usr/share/OVMF/OVMF_CODE.fd",
+			Vars: template,
+		},
+	}, l)
+
+	require.Nil(t, vm.Start())
+
+	firmware := l.Processes()[0].Config.Firmware
+	assert.Equal(t, firmware.Code, "/usr/share/OVMF/OVMF_CODE.fd")
+	assert.Equal(t, firmware.Vars, filepath.Join(vm.WorkDir(), "OVMF_VARS.fd"))
+	assert.Equal(t, vm.Config.Firmware.Vars, template)
+
+	vars, err := ioutil.ReadFile(firmware.Vars)
+	assert.Nil(t, err)
+	assert.Equal(t, string(vars), "vars")
+
+	assert.Nil(t, vm.Quit())
+	assert.Nil(t, vm.Wait())
+
+	_, err = os.Stat(vm.WorkDir())
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,20 @@
+module github.com/bytearena/schnapps
+
+go 1.20
+
+require (
+	github.com/digitalocean/go-qemu v0.0.0-20250212194115-ee9b0668d242
+	github.com/gorilla/websocket v1.5.0
+	github.com/miekg/dns v1.1.25
+	github.com/stretchr/testify v1.8.4
+	golang.org/x/sys v0.30.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/crypto v0.14.0 // indirect
+	golang.org/x/net v0.17.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
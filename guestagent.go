@@ -0,0 +1,142 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/bytearena/schnapps/guestagent"
+	"github.com/bytearena/schnapps/types"
+)
+
+var (
+	// Bounds each ping of the guest agent boot check, the agent doesn't reply
+	// until the guest has started qemu-ga
+	GUEST_AGENT_PING_TIMEOUT = time.Duration(time.Second)
+
+	ErrNoGuestAgent = errors.New("The VM has no guest agent channel")
+)
+
+// Client of the guest agent of the running VM, connected on first use. Its
+// commands fail when their context is done if the guest doesn't run qemu-ga.
+func (vm *VM) GuestAgent(ctx context.Context) (*guestagent.Client, error) {
+	if vm.Config.GuestAgent == nil {
+		return nil, ErrNoGuestAgent
+	}
+
+	vm.guestAgentMutex.Lock()
+	defer vm.guestAgentMutex.Unlock()
+
+	if vm.guestAgent != nil {
+		return vm.guestAgent, nil
+	}
+
+	if vm.guestAgentSocket == "" {
+		return nil, errors.New("No guest agent: the VM is not running")
+	}
+
+	client, err := guestagent.Dial(ctx, vm.guestAgentSocket)
+
+	if err != nil {
+		return nil, errors.New("Could not connect to the guest agent: " + err.Error())
+	}
+
+	vm.guestAgent = client
+
+	return client, nil
+}
+
+// Runs the program in the guest and waits for it to exit
+func (vm *VM) GuestExec(ctx context.Context, path string, args ...string) (guestagent.ExecStatus, error) {
+	client, err := vm.GuestAgent(ctx)
+
+	if err != nil {
+		return guestagent.ExecStatus{}, err
+	}
+
+	return client.Run(ctx, path, args...)
+}
+
+// Addresses of the network interfaces of the guest, as reported by its agent.
+// The loopback and link-local addresses are excluded.
+func (vm *VM) GuestIPs(ctx context.Context) ([]net.IP, error) {
+	client, err := vm.GuestAgent(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces, err := client.NetworkGetInterfaces(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ips := []net.IP{}
+
+	for _, iface := range interfaces {
+		for _, addr := range iface.IPAddresses {
+			ip := net.ParseIP(addr.Address)
+
+			if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+				continue
+			}
+
+			ips = append(ips, ip)
+		}
+	}
+
+	return ips, nil
+}
+
+// The channel socket is in the work directory unless configured
+func (vm *VM) prepareGuestAgent(config types.VMConfig) (types.VMConfig, error) {
+	if config.GuestAgent == nil {
+		return config, nil
+	}
+
+	agent := *config.GuestAgent
+
+	if agent.Socket == "" {
+		if err := vm.createWorkDir(); err != nil {
+			return config, err
+		}
+
+		agent.Socket = filepath.Join(vm.workDir, "qga.sock")
+	}
+
+	vm.guestAgentMutex.Lock()
+	vm.guestAgentSocket = agent.Socket
+	vm.guestAgentMutex.Unlock()
+
+	config.GuestAgent = &agent
+
+	return config, nil
+}
+
+func (vm *VM) pingGuestAgent(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, GUEST_AGENT_PING_TIMEOUT)
+	defer cancel()
+
+	client, err := vm.GuestAgent(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return client.Ping(ctx)
+}
+
+func (vm *VM) closeGuestAgent() {
+	vm.guestAgentMutex.Lock()
+	defer vm.guestAgentMutex.Unlock()
+
+	if vm.guestAgent != nil {
+		vm.logError(vm.guestAgent.Close(), "Could not close the guest agent connection")
+		vm.guestAgent = nil
+	}
+
+	vm.guestAgentSocket = ""
+}
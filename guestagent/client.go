@@ -0,0 +1,283 @@
+// Package guestagent is a client of the QEMU guest agent (qemu-ga), which
+// runs in the guest and is reached through a virtio-serial channel exposed by
+// QEMU on a Unix socket.
+package guestagent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// Name of the virtio-serial port qemu-ga listens on
+	CHANNEL_NAME = "org.qemu.guest_agent.0"
+
+	ErrClosed = errors.New("Guest agent connection closed")
+)
+
+// Message sent to the agent
+type Command struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+// Error reply from the agent
+type Error struct {
+	Command string `json:"-"`
+	Class   string `json:"class"`
+	Desc    string `json:"desc"`
+}
+
+func (e *Error) Error() string {
+	return "Guest agent " + e.Command + " failed (" + e.Class + "): " + e.Desc
+}
+
+type reply struct {
+	Return json.RawMessage `json:"return"`
+	Error  *Error          `json:"error"`
+}
+
+// Commands are run one at a time. The agent doesn't tag its replies, the
+// stream is resynchronized with guest-sync-delimited on connection and after
+// an interrupted command.
+type Client struct {
+	conn net.Conn
+
+	mutex    sync.Mutex
+	decoder  *json.Decoder
+	unsynced bool
+
+	closed     bool
+	closeMutex sync.Mutex
+}
+
+// Connects to the Unix socket of the channel. Doesn't fail if the agent is not
+// running yet, the commands do.
+func Dial(ctx context.Context, path string) (*Client, error) {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "unix", path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(conn), nil
+}
+
+func NewClient(conn net.Conn) *Client {
+	return &Client{
+		conn:     conn,
+		unsynced: true,
+	}
+}
+
+// Runs the command and decodes its return value into res, unless res is nil.
+// Error replies are returned as *Error.
+func (c *Client) Execute(ctx context.Context, cmd Command, res interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	stop := c.watch(ctx)
+	defer stop()
+
+	if c.unsynced {
+		if err := c.sync(); err != nil {
+			return c.ioErr(ctx, err)
+		}
+	}
+
+	if err := c.send(cmd); err != nil {
+		c.unsynced = true
+		return c.ioErr(ctx, err)
+	}
+
+	var r reply
+
+	if err := c.decoder.Decode(&r); err != nil {
+		// The reply may still come, it must be skipped
+		c.unsynced = true
+		return c.ioErr(ctx, err)
+	}
+
+	if r.Error != nil {
+		r.Error.Command = cmd.Execute
+		return r.Error
+	}
+
+	if res == nil || len(r.Return) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(r.Return, res)
+}
+
+// Sends a command the agent doesn't reply to on success
+func (c *Client) executeNoReply(ctx context.Context, cmd Command) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	stop := c.watch(ctx)
+	defer stop()
+
+	if c.unsynced {
+		if err := c.sync(); err != nil {
+			return c.ioErr(ctx, err)
+		}
+	}
+
+	// An error reply would be read by the next command
+	c.unsynced = true
+
+	return c.ioErr(ctx, c.send(cmd))
+}
+
+// Interrupts the running command
+func (c *Client) Close() error {
+	c.closeMutex.Lock()
+	defer c.closeMutex.Unlock()
+
+	if c.closed {
+		return nil
+	}
+
+	c.closed = true
+
+	return c.conn.Close()
+}
+
+func (c *Client) isClosed() bool {
+	c.closeMutex.Lock()
+	defer c.closeMutex.Unlock()
+
+	return c.closed
+}
+
+// Interrupts the I/O on the connection when the context is done
+func (c *Client) watch(ctx context.Context) (stop func()) {
+	deadline, _ := ctx.Deadline()
+	c.conn.SetDeadline(deadline)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+			c.conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (c *Client) send(cmd Command) error {
+	data, err := json.Marshal(cmd)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = c.conn.Write(data)
+
+	return err
+}
+
+// Discards the pending output of the agent, up to the reply of
+// guest-sync-delimited, which is preceded by a 0xFF byte.
+func (c *Client) sync() error {
+	id := rand.Int63n(1 << 52)
+
+	// Resets the parser of the agent
+	if _, err := c.conn.Write([]byte{0xFF}); err != nil {
+		return err
+	}
+
+	err := c.send(Command{
+		Execute:   "guest-sync-delimited",
+		Arguments: map[string]int64{"id": id},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(c.conn)
+
+	for {
+		if _, err := reader.ReadBytes(0xFF); err != nil {
+			return err
+		}
+
+		decoder := json.NewDecoder(reader)
+
+		var r reply
+
+		err := decoder.Decode(&r)
+
+		switch err.(type) {
+		case nil:
+			var synced int64
+
+			if r.Error == nil && json.Unmarshal(r.Return, &synced) == nil && synced == id {
+				c.decoder = decoder
+				c.unsynced = false
+
+				return nil
+			}
+		case *json.SyntaxError, *json.UnmarshalTypeError:
+			// Garbage after a 0xFF in the pending output
+		default:
+			return err
+		}
+
+		// The decoder may have buffered the next 0xFF, the search goes on
+		// from the bytes it didn't parse
+		reader = bufio.NewReader(io.MultiReader(decoder.Buffered(), reader))
+	}
+}
+
+// The error of the context or ErrClosed, if the I/O was interrupted because
+// of them
+func (c *Client) ioErr(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// The deadline of the connection expired just before the context
+	if _, hasDeadline := ctx.Deadline(); hasDeadline && errors.Is(err, os.ErrDeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+
+	return err
+}
@@ -0,0 +1,232 @@
+package guestagent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type received struct {
+	Execute   string `json:"execute"`
+	Arguments struct {
+		Id int64 `json:"id"`
+	} `json:"arguments"`
+}
+
+// Agent side of the connection, scripted by the test
+type fakePeer struct {
+	conn     net.Conn
+	commands chan received
+}
+
+// Drops the 0xFF bytes sent by the client
+type dropDelimiter struct {
+	reader io.Reader
+}
+
+func (d dropDelimiter) Read(p []byte) (int, error) {
+	for {
+		n, err := d.reader.Read(p)
+		out := 0
+
+		for _, b := range p[:n] {
+			if b != 0xFF {
+				p[out] = b
+				out++
+			}
+		}
+
+		if out > 0 || err != nil {
+			return out, err
+		}
+	}
+}
+
+func newFakePeer(t *testing.T) (*Client, *fakePeer) {
+	clientConn, peerConn := net.Pipe()
+
+	p := &fakePeer{conn: peerConn, commands: make(chan received, 16)}
+
+	go func() {
+		decoder := json.NewDecoder(dropDelimiter{peerConn})
+
+		for {
+			var cmd received
+
+			if err := decoder.Decode(&cmd); err != nil {
+				close(p.commands)
+				return
+			}
+
+			p.commands <- cmd
+		}
+	}()
+
+	t.Cleanup(func() { peerConn.Close() })
+
+	return NewClient(clientConn), p
+}
+
+func (p *fakePeer) next(t *testing.T) received {
+	select {
+	case cmd := <-p.commands:
+		return cmd
+	case <-time.After(time.Second):
+		require.FailNow(t, "No command received")
+	}
+
+	return received{}
+}
+
+func (p *fakePeer) reply(t *testing.T, reply string) {
+	_, err := p.conn.Write([]byte(reply))
+	require.Nil(t, err)
+}
+
+func (p *fakePeer) sync(t *testing.T) {
+	cmd := p.next(t)
+	require.Equal(t, cmd.Execute, "guest-sync-delimited")
+
+	p.reply(t, "\xff{\"return\": "+strconv.FormatInt(cmd.Arguments.Id, 10)+"}\n")
+}
+
+func TestClientSync(t *testing.T) {
+	client, peer := newFakePeer(t)
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- client.Ping(context.Background())
+	}()
+
+	cmd := peer.next(t)
+	assert.Equal(t, cmd.Execute, "guest-sync-delimited")
+
+	// Output of a previous session
+	peer.reply(t, `{"return": {}}`+"\n")
+	peer.reply(t, "\xff"+`{"return": 42}`+"\n")
+	peer.reply(t, "\xff"+`{"return": `+strconv.FormatInt(cmd.Arguments.Id, 10)+"}\n")
+
+	assert.Equal(t, peer.next(t).Execute, "guest-ping")
+	peer.reply(t, `{"return": {}}`+"\n")
+
+	assert.Nil(t, <-errs)
+
+	// Synchronized once
+	go func() {
+		errs <- client.Ping(context.Background())
+	}()
+
+	assert.Equal(t, peer.next(t).Execute, "guest-ping")
+	peer.reply(t, `{"return": {}}`+"\n")
+
+	assert.Nil(t, <-errs)
+}
+
+func TestClientSyncGarbage(t *testing.T) {
+	client, peer := newFakePeer(t)
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- client.Ping(context.Background())
+	}()
+
+	cmd := peer.next(t)
+	assert.Equal(t, cmd.Execute, "guest-sync-delimited")
+
+	// Read at once by the JSON decoder
+	peer.reply(t, "\xff{garbage\xff"+`{"return": 42}`+"\xff"+`{"return": `+strconv.FormatInt(cmd.Arguments.Id, 10)+"}\n")
+
+	assert.Equal(t, peer.next(t).Execute, "guest-ping")
+	peer.reply(t, `{"return": {}}`+"\n")
+
+	assert.Nil(t, <-errs)
+}
+
+func TestClientError(t *testing.T) {
+	client, peer := newFakePeer(t)
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- client.Execute(context.Background(), Command{Execute: "guest-foo"}, nil)
+	}()
+
+	peer.sync(t)
+	assert.Equal(t, peer.next(t).Execute, "guest-foo")
+	peer.reply(t, `{"error": {"class": "CommandNotFound", "desc": "The command guest-foo has not been found"}}`+"\n")
+
+	err := <-errs
+
+	agentErr, ok := err.(*Error)
+	require.True(t, ok)
+	assert.Equal(t, agentErr.Command, "guest-foo")
+	assert.Equal(t, agentErr.Class, "CommandNotFound")
+	assert.Equal(t, err.Error(), "Guest agent guest-foo failed (CommandNotFound): The command guest-foo has not been found")
+}
+
+func TestClientContext(t *testing.T) {
+	client, peer := newFakePeer(t)
+
+	// The agent is not running
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, client.Ping(ctx), context.DeadlineExceeded)
+
+	first := peer.next(t)
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- client.Ping(context.Background())
+	}()
+
+	// The agent started and replies to both syncs
+	peer.reply(t, "\xff"+`{"return": `+strconv.FormatInt(first.Arguments.Id, 10)+"}\n")
+	peer.sync(t)
+
+	assert.Equal(t, peer.next(t).Execute, "guest-ping")
+	peer.reply(t, `{"return": {}}`+"\n")
+
+	assert.Nil(t, <-errs)
+}
+
+func TestClientClosed(t *testing.T) {
+	client, _ := newFakePeer(t)
+
+	assert.Nil(t, client.Close())
+	assert.Nil(t, client.Close())
+	assert.Equal(t, client.Ping(context.Background()), ErrClosed)
+}
+
+func TestWriteFileShortWrite(t *testing.T) {
+	client, peer := newFakePeer(t)
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- client.WriteFile(context.Background(), "/etc/hostname", []byte("vm2\n"))
+	}()
+
+	peer.sync(t)
+	assert.Equal(t, peer.next(t).Execute, "guest-file-open")
+	peer.reply(t, `{"return": 1}`+"\n")
+
+	// Nothing written, without an error
+	assert.Equal(t, peer.next(t).Execute, "guest-file-write")
+	peer.reply(t, `{"return": {"count": 0, "eof": false}}`+"\n")
+
+	assert.Equal(t, peer.next(t).Execute, "guest-file-close")
+	peer.reply(t, `{"return": {}}`+"\n")
+
+	assert.NotNil(t, <-errs)
+}
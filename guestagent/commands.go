@@ -0,0 +1,270 @@
+package guestagent
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+var (
+	EXEC_POLL_INTERVAL = time.Duration(100 * time.Millisecond)
+
+	// Bytes read by ReadFile at once
+	FILE_READ_CHUNK = 64 * 1024
+)
+
+// Return value of guest-exec-status
+type ExecStatus struct {
+	Exited   bool `json:"exited"`
+	ExitCode int  `json:"exitcode"`
+	// Set if the process was killed by a signal
+	Signal int `json:"signal"`
+
+	OutData      string `json:"out-data"`
+	ErrData      string `json:"err-data"`
+	OutTruncated bool   `json:"out-truncated"`
+	ErrTruncated bool   `json:"err-truncated"`
+}
+
+// Decoded output of the process
+func (s ExecStatus) Stdout() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(s.OutData)
+}
+
+func (s ExecStatus) Stderr() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(s.ErrData)
+}
+
+// Element of the return value of guest-network-get-interfaces
+type Interface struct {
+	Name            string      `json:"name"`
+	HardwareAddress string      `json:"hardware-address"`
+	IPAddresses     []IPAddress `json:"ip-addresses"`
+}
+
+type IPAddress struct {
+	// ipv4 or ipv6
+	Type    string `json:"ip-address-type"`
+	Address string `json:"ip-address"`
+	Prefix  int    `json:"prefix"`
+}
+
+type fileReadResult struct {
+	Count  int    `json:"count"`
+	BufB64 string `json:"buf-b64"`
+	EOF    bool   `json:"eof"`
+}
+
+type fileWriteResult struct {
+	Count int  `json:"count"`
+	EOF   bool `json:"eof"`
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	return c.Execute(ctx, Command{Execute: "guest-ping"}, nil)
+}
+
+// Starts the program in the guest, with its output captured. Returns the pid
+// of the process, see ExecStatus.
+func (c *Client) Exec(ctx context.Context, path string, args []string, env []string, input []byte) (int, error) {
+	arguments := map[string]interface{}{
+		"path":           path,
+		"capture-output": true,
+	}
+
+	if len(args) > 0 {
+		arguments["arg"] = args
+	}
+
+	if len(env) > 0 {
+		arguments["env"] = env
+	}
+
+	if len(input) > 0 {
+		arguments["input-data"] = base64.StdEncoding.EncodeToString(input)
+	}
+
+	var res struct {
+		Pid int `json:"pid"`
+	}
+
+	err := c.Execute(ctx, Command{Execute: "guest-exec", Arguments: arguments}, &res)
+
+	return res.Pid, err
+}
+
+func (c *Client) ExecStatus(ctx context.Context, pid int) (ExecStatus, error) {
+	var status ExecStatus
+
+	err := c.Execute(ctx, Command{Execute: "guest-exec-status", Arguments: map[string]int{"pid": pid}}, &status)
+
+	return status, err
+}
+
+// Runs the program in the guest and waits for it to exit
+func (c *Client) Run(ctx context.Context, path string, args ...string) (ExecStatus, error) {
+	pid, err := c.Exec(ctx, path, args, nil, nil)
+
+	if err != nil {
+		return ExecStatus{}, err
+	}
+
+	for {
+		status, err := c.ExecStatus(ctx, pid)
+
+		if err != nil || status.Exited {
+			return status, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-time.After(EXEC_POLL_INTERVAL):
+		}
+	}
+}
+
+// Opens the file in the guest with the fopen mode (r, w, a, r+, …) and
+// returns its handle
+func (c *Client) FileOpen(ctx context.Context, path, mode string) (int, error) {
+	var handle int
+
+	err := c.Execute(ctx, Command{
+		Execute:   "guest-file-open",
+		Arguments: map[string]string{"path": path, "mode": mode},
+	}, &handle)
+
+	return handle, err
+}
+
+// Reads up to count bytes
+func (c *Client) FileRead(ctx context.Context, handle, count int) ([]byte, bool, error) {
+	var res fileReadResult
+
+	err := c.Execute(ctx, Command{
+		Execute:   "guest-file-read",
+		Arguments: map[string]int{"handle": handle, "count": count},
+	}, &res)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(res.BufB64)
+
+	return data, res.EOF, err
+}
+
+// Returns the amount of bytes written
+func (c *Client) FileWrite(ctx context.Context, handle int, data []byte) (int, error) {
+	var res fileWriteResult
+
+	err := c.Execute(ctx, Command{
+		Execute: "guest-file-write",
+		Arguments: map[string]interface{}{
+			"handle":  handle,
+			"buf-b64": base64.StdEncoding.EncodeToString(data),
+		},
+	}, &res)
+
+	return res.Count, err
+}
+
+func (c *Client) FileClose(ctx context.Context, handle int) error {
+	return c.Execute(ctx, Command{Execute: "guest-file-close", Arguments: map[string]int{"handle": handle}}, nil)
+}
+
+// Reads the whole file of the guest
+func (c *Client) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	handle, err := c.FileOpen(ctx, path, "r")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.FileClose(ctx, handle)
+
+	content := []byte{}
+
+	for {
+		data, eof, err := c.FileRead(ctx, handle, FILE_READ_CHUNK)
+
+		if err != nil {
+			return nil, err
+		}
+
+		content = append(content, data...)
+
+		if eof || len(data) == 0 {
+			return content, nil
+		}
+	}
+}
+
+// Creates or truncates the file of the guest
+func (c *Client) WriteFile(ctx context.Context, path string, data []byte) error {
+	handle, err := c.FileOpen(ctx, path, "w")
+
+	if err != nil {
+		return err
+	}
+
+	for len(data) > 0 {
+		n, err := c.FileWrite(ctx, handle, data)
+
+		if err == nil && (n <= 0 || n > len(data)) {
+			err = fmt.Errorf("Could not write %s: %d of %d bytes written", path, n, len(data))
+		}
+
+		if err != nil {
+			c.FileClose(ctx, handle)
+			return err
+		}
+
+		data = data[n:]
+	}
+
+	return c.FileClose(ctx, handle)
+}
+
+func (c *Client) NetworkGetInterfaces(ctx context.Context) ([]Interface, error) {
+	var interfaces []Interface
+
+	err := c.Execute(ctx, Command{Execute: "guest-network-get-interfaces"}, &interfaces)
+
+	return interfaces, err
+}
+
+// Freezes the filesystems of the guest, to take a consistent snapshot of its
+// disks. Returns the number of frozen filesystems.
+func (c *Client) FSFreeze(ctx context.Context) (int, error) {
+	var count int
+
+	err := c.Execute(ctx, Command{Execute: "guest-fsfreeze-freeze"}, &count)
+
+	return count, err
+}
+
+// Returns the number of thawed filesystems
+func (c *Client) FSThaw(ctx context.Context) (int, error) {
+	var count int
+
+	err := c.Execute(ctx, Command{Execute: "guest-fsfreeze-thaw"}, &count)
+
+	return count, err
+}
+
+// thawed or frozen
+func (c *Client) FSFreezeStatus(ctx context.Context) (string, error) {
+	var status string
+
+	err := c.Execute(ctx, Command{Execute: "guest-fsfreeze-status"}, &status)
+
+	return status, err
+}
+
+// Asks the guest to powerdown, halt or reboot. The agent doesn't reply.
+func (c *Client) Shutdown(ctx context.Context, mode string) error {
+	return c.executeNoReply(ctx, Command{Execute: "guest-shutdown", Arguments: map[string]string{"mode": mode}})
+}
@@ -0,0 +1,629 @@
+// Package guestagenttest provides an in-memory QEMU guest agent, listening on
+// a Unix socket like the channel exposed by QEMU, to test code using the guest
+// agent without a guest.
+package guestagenttest
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/bytearena/schnapps/guestagent"
+)
+
+var (
+	// Filesystems frozen by guest-fsfreeze-freeze
+	FAKE_FILESYSTEMS = 2
+)
+
+// Computes the return value of a command, a non-nil *guestagent.Error is sent
+// as an error reply.
+type commandHandler func(args json.RawMessage) (interface{}, *guestagent.Error)
+
+// Simulates a program run by guest-exec
+type Program func(args []string, input []byte) (stdout, stderr []byte, code int)
+
+// Command received by the agent
+type Command struct {
+	Execute   string          `json:"execute"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type process struct {
+	status guestagent.ExecStatus
+}
+
+type openFile struct {
+	path   string
+	offset int
+}
+
+type Agent struct {
+	listener net.Listener
+
+	mutex      sync.Mutex
+	handlers   map[string]commandHandler
+	after      map[string][]func()
+	commands   []Command
+	conns      map[net.Conn]bool
+	available  bool
+	frozen     bool
+	interfaces []guestagent.Interface
+	programs   map[string]Program
+	processes  map[int]*process
+	files      map[string][]byte
+	handles    map[int]*openFile
+	lastId     int
+}
+
+// Starts an agent listening on the Unix socket. By default it implements
+// guest-sync-delimited, guest-ping, guest-exec, guest-file-*,
+// guest-network-get-interfaces, guest-fsfreeze-* and guest-shutdown, on top
+// of an in-memory guest. Other commands reply with a CommandNotFound error.
+func Listen(path string) (*Agent, error) {
+	listener, err := net.Listen("unix", path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Agent{
+		listener:  listener,
+		handlers:  make(map[string]commandHandler),
+		after:     make(map[string][]func()),
+		conns:     make(map[net.Conn]bool),
+		available: true,
+		programs:  make(map[string]Program),
+		processes: make(map[int]*process),
+		files:     make(map[string][]byte),
+		handles:   make(map[int]*openFile),
+		interfaces: []guestagent.Interface{{
+			Name:            "lo",
+			HardwareAddress: "00:00:00:00:00:00",
+			IPAddresses: []guestagent.IPAddress{
+				{Type: "ipv4", Address: "127.0.0.1", Prefix: 8},
+				{Type: "ipv6", Address: "::1", Prefix: 128},
+			},
+		}},
+	}
+
+	a.registerDefaultHandlers()
+
+	go a.accept()
+
+	return a, nil
+}
+
+func (a *Agent) Path() string {
+	return a.listener.Addr().String()
+}
+
+// An unavailable agent discards the commands without replying, like the
+// channel of a guest which hasn't started qemu-ga yet.
+func (a *Agent) SetAvailable(available bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.available = available
+}
+
+// Calls fn after each successful call of the command.
+func (a *Agent) After(command string, fn func()) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.after[command] = append(a.after[command], fn)
+}
+
+// Interfaces returned by guest-network-get-interfaces, after the loopback.
+func (a *Agent) AddInterface(iface guestagent.Interface) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.interfaces = append(a.interfaces, iface)
+}
+
+// Program run by guest-exec for the path. Other paths fail like a missing
+// executable.
+func (a *Agent) SetProgram(path string, program Program) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.programs[path] = program
+}
+
+// Content of a file of the guest
+func (a *Agent) SetFile(path string, content []byte) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.files[path] = append([]byte{}, content...)
+}
+
+func (a *Agent) File(path string) ([]byte, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	content, ok := a.files[path]
+
+	return append([]byte{}, content...), ok
+}
+
+func (a *Agent) Frozen() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.frozen
+}
+
+// Commands received so far, in order, excluding guest-sync-delimited.
+func (a *Agent) Commands() []Command {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return append([]Command{}, a.commands...)
+}
+
+// Closes the listener and every connection.
+func (a *Agent) Close() error {
+	err := a.listener.Close()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for c := range a.conns {
+		c.Close()
+		delete(a.conns, c)
+	}
+
+	return err
+}
+
+func (a *Agent) accept() {
+	for {
+		c, err := a.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		a.mutex.Lock()
+		a.conns[c] = true
+		a.mutex.Unlock()
+
+		go a.serve(c)
+	}
+}
+
+// 0xFF resets the parser of qemu-ga, it never appears in JSON
+type delimiterFilter struct {
+	reader *bufio.Reader
+}
+
+func (f delimiterFilter) Read(p []byte) (int, error) {
+	n := 0
+
+	for n < len(p) {
+		if n > 0 && f.reader.Buffered() == 0 {
+			break
+		}
+
+		b, err := f.reader.ReadByte()
+
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+
+			return 0, err
+		}
+
+		if b != 0xFF {
+			p[n] = b
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (a *Agent) serve(c net.Conn) {
+	defer func() {
+		a.mutex.Lock()
+		delete(a.conns, c)
+		a.mutex.Unlock()
+
+		c.Close()
+	}()
+
+	decoder := json.NewDecoder(delimiterFilter{bufio.NewReader(c)})
+
+	for {
+		var cmd Command
+
+		if err := decoder.Decode(&cmd); err != nil {
+			if err != io.EOF {
+				c.Write(errorReply(&guestagent.Error{Class: "GenericError", Desc: "Invalid JSON syntax"}))
+			}
+
+			return
+		}
+
+		a.mutex.Lock()
+		available := a.available
+		a.mutex.Unlock()
+
+		if !available {
+			continue
+		}
+
+		if cmd.Execute == "guest-sync-delimited" || cmd.Execute == "guest-sync" {
+			var args struct {
+				Id int64 `json:"id"`
+			}
+
+			json.Unmarshal(cmd.Arguments, &args)
+
+			reply := returnReply(args.Id)
+
+			if cmd.Execute == "guest-sync-delimited" {
+				reply = append([]byte{0xFF}, reply...)
+			}
+
+			if _, err := c.Write(reply); err != nil {
+				return
+			}
+
+			continue
+		}
+
+		reply, ok := a.dispatch(cmd)
+
+		if reply != nil {
+			if _, err := c.Write(reply); err != nil {
+				return
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		a.mutex.Lock()
+		after := a.after[cmd.Execute]
+		a.mutex.Unlock()
+
+		for _, fn := range after {
+			fn()
+		}
+	}
+}
+
+func (a *Agent) dispatch(cmd Command) ([]byte, bool) {
+	a.mutex.Lock()
+	a.commands = append(a.commands, cmd)
+	handler, hasHandler := a.handlers[cmd.Execute]
+	frozen := a.frozen
+	a.mutex.Unlock()
+
+	if !hasHandler {
+		return errorReply(&guestagent.Error{
+			Class: "CommandNotFound",
+			Desc:  "The command " + cmd.Execute + " has not been found",
+		}), false
+	}
+
+	// Like qemu-ga, only a few commands are allowed while the filesystems
+	// are frozen
+	switch cmd.Execute {
+	case "guest-ping", "guest-fsfreeze-status", "guest-fsfreeze-thaw":
+	default:
+		if frozen {
+			return errorReply(&guestagent.Error{
+				Class: "CommandNotFound",
+				Desc:  "Command " + cmd.Execute + " has been disabled: the agent is in frozen state",
+			}), false
+		}
+	}
+
+	res, agentErr := handler(cmd.Arguments)
+
+	if agentErr != nil {
+		return errorReply(agentErr), false
+	}
+
+	// No reply on success
+	if cmd.Execute == "guest-shutdown" {
+		return nil, true
+	}
+
+	if res == nil {
+		res = struct{}{}
+	}
+
+	return returnReply(res), true
+}
+
+func returnReply(res interface{}) []byte {
+	buf, _ := json.Marshal(map[string]interface{}{"return": res})
+
+	return append(buf, '\n')
+}
+
+func errorReply(err *guestagent.Error) []byte {
+	buf, _ := json.Marshal(map[string]interface{}{"error": err})
+
+	return append(buf, '\n')
+}
+
+func invalidParameter(desc string) *guestagent.Error {
+	return &guestagent.Error{Class: "GenericError", Desc: desc}
+}
+
+func unknownHandle(handle int) *guestagent.Error {
+	return invalidParameter("handle '" + strconv.Itoa(handle) + "' has not been found")
+}
+
+// Mimics qemu-ga
+func (a *Agent) registerDefaultHandlers() {
+	a.handlers["guest-ping"] = func(args json.RawMessage) (interface{}, *guestagent.Error) {
+		return nil, nil
+	}
+
+	a.handlers["guest-shutdown"] = func(args json.RawMessage) (interface{}, *guestagent.Error) {
+		return nil, nil
+	}
+
+	a.handlers["guest-network-get-interfaces"] = func(args json.RawMessage) (interface{}, *guestagent.Error) {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+
+		return append([]guestagent.Interface{}, a.interfaces...), nil
+	}
+
+	a.handlers["guest-exec"] = a.exec
+	a.handlers["guest-exec-status"] = a.execStatus
+
+	a.handlers["guest-file-open"] = a.fileOpen
+	a.handlers["guest-file-read"] = a.fileRead
+	a.handlers["guest-file-write"] = a.fileWrite
+	a.handlers["guest-file-close"] = a.fileClose
+
+	a.handlers["guest-fsfreeze-freeze"] = func(args json.RawMessage) (interface{}, *guestagent.Error) {
+		return a.setFrozen(true), nil
+	}
+
+	a.handlers["guest-fsfreeze-thaw"] = func(args json.RawMessage) (interface{}, *guestagent.Error) {
+		return a.setFrozen(false), nil
+	}
+
+	a.handlers["guest-fsfreeze-status"] = func(args json.RawMessage) (interface{}, *guestagent.Error) {
+		if a.Frozen() {
+			return "frozen", nil
+		}
+
+		return "thawed", nil
+	}
+}
+
+// Returns the number of filesystems frozen or thawed
+func (a *Agent) setFrozen(frozen bool) int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.frozen == frozen {
+		return 0
+	}
+
+	a.frozen = frozen
+
+	return FAKE_FILESYSTEMS
+}
+
+// The program runs to completion before the reply
+func (a *Agent) exec(raw json.RawMessage) (interface{}, *guestagent.Error) {
+	var args struct {
+		Path      string   `json:"path"`
+		Arg       []string `json:"arg"`
+		InputData string   `json:"input-data"`
+	}
+
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, invalidParameter(err.Error())
+	}
+
+	input, err := base64.StdEncoding.DecodeString(args.InputData)
+
+	if err != nil {
+		return nil, invalidParameter("Invalid input-data: " + err.Error())
+	}
+
+	a.mutex.Lock()
+	program, ok := a.programs[args.Path]
+	a.mutex.Unlock()
+
+	if !ok {
+		return nil, invalidParameter("Guest agent command failed, error was 'Failed to execute child process \"" +
+			args.Path + "\" (No such file or directory)'")
+	}
+
+	stdout, stderr, code := program(args.Arg, input)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.lastId++
+	a.processes[a.lastId] = &process{status: guestagent.ExecStatus{
+		Exited:   true,
+		ExitCode: code,
+		OutData:  base64.StdEncoding.EncodeToString(stdout),
+		ErrData:  base64.StdEncoding.EncodeToString(stderr),
+	}}
+
+	return map[string]int{"pid": a.lastId}, nil
+}
+
+// The status of an exited process can only be read once, like qemu-ga
+func (a *Agent) execStatus(raw json.RawMessage) (interface{}, *guestagent.Error) {
+	var args struct {
+		Pid int `json:"pid"`
+	}
+
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, invalidParameter(err.Error())
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	p, ok := a.processes[args.Pid]
+
+	if !ok {
+		return nil, invalidParameter("Invalid parameter 'pid'")
+	}
+
+	delete(a.processes, args.Pid)
+
+	return p.status, nil
+}
+
+func (a *Agent) fileOpen(raw json.RawMessage) (interface{}, *guestagent.Error) {
+	var args struct {
+		Path string `json:"path"`
+		Mode string `json:"mode"`
+	}
+
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, invalidParameter(err.Error())
+	}
+
+	if args.Mode == "" {
+		args.Mode = "r"
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	_, exists := a.files[args.Path]
+	f := &openFile{path: args.Path}
+
+	switch args.Mode {
+	case "r", "r+":
+		if !exists {
+			return nil, invalidParameter("failed to open file '" + args.Path + "' (mode: '" + args.Mode + "'): No such file or directory")
+		}
+	case "w", "w+":
+		a.files[args.Path] = []byte{}
+	case "a", "a+":
+		if !exists {
+			a.files[args.Path] = []byte{}
+		}
+
+		f.offset = len(a.files[args.Path])
+	default:
+		return nil, invalidParameter("invalid file open mode '" + args.Mode + "'")
+	}
+
+	a.lastId++
+	a.handles[a.lastId] = f
+
+	return a.lastId, nil
+}
+
+func (a *Agent) fileRead(raw json.RawMessage) (interface{}, *guestagent.Error) {
+	var args struct {
+		Handle int `json:"handle"`
+		Count  int `json:"count"`
+	}
+
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, invalidParameter(err.Error())
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	f, ok := a.handles[args.Handle]
+
+	if !ok {
+		return nil, unknownHandle(args.Handle)
+	}
+
+	content := a.files[f.path]
+	data := content[f.offset:]
+
+	if len(data) > args.Count {
+		data = data[:args.Count]
+	}
+
+	f.offset += len(data)
+
+	return map[string]interface{}{
+		"count":   len(data),
+		"buf-b64": base64.StdEncoding.EncodeToString(data),
+		"eof":     f.offset >= len(content),
+	}, nil
+}
+
+func (a *Agent) fileWrite(raw json.RawMessage) (interface{}, *guestagent.Error) {
+	var args struct {
+		Handle int    `json:"handle"`
+		BufB64 string `json:"buf-b64"`
+	}
+
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, invalidParameter(err.Error())
+	}
+
+	data, err := base64.StdEncoding.DecodeString(args.BufB64)
+
+	if err != nil {
+		return nil, invalidParameter("Invalid buf-b64: " + err.Error())
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	f, ok := a.handles[args.Handle]
+
+	if !ok {
+		return nil, unknownHandle(args.Handle)
+	}
+
+	content := a.files[f.path]
+
+	if end := f.offset + len(data); end > len(content) {
+		content = append(content, make([]byte, end-len(content))...)
+	}
+
+	copy(content[f.offset:], data)
+	f.offset += len(data)
+	a.files[f.path] = content
+
+	return map[string]interface{}{"count": len(data), "eof": false}, nil
+}
+
+func (a *Agent) fileClose(raw json.RawMessage) (interface{}, *guestagent.Error) {
+	var args struct {
+		Handle int `json:"handle"`
+	}
+
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, invalidParameter(err.Error())
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.handles[args.Handle]; !ok {
+		return nil, unknownHandle(args.Handle)
+	}
+
+	delete(a.handles, args.Handle)
+
+	return nil, nil
+}
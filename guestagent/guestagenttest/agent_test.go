@@ -0,0 +1,195 @@
+package guestagenttest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytearena/schnapps/guestagent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listen(t *testing.T) (*Agent, *guestagent.Client) {
+	dir, err := ioutil.TempDir("", "guestagent")
+	require.Nil(t, err)
+
+	agent, err := Listen(filepath.Join(dir, "qga.sock"))
+	require.Nil(t, err)
+
+	client, err := guestagent.Dial(context.Background(), agent.Path())
+	require.Nil(t, err)
+
+	t.Cleanup(func() {
+		client.Close()
+		agent.Close()
+		os.RemoveAll(dir)
+	})
+
+	return agent, client
+}
+
+func TestAgentPing(t *testing.T) {
+	agent, client := listen(t)
+
+	assert.Nil(t, client.Ping(context.Background()))
+
+	commands := agent.Commands()
+	require.Len(t, commands, 1)
+	assert.Equal(t, commands[0].Execute, "guest-ping")
+}
+
+func TestAgentUnavailable(t *testing.T) {
+	agent, client := listen(t)
+	agent.SetAvailable(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, client.Ping(ctx), context.DeadlineExceeded)
+
+	agent.SetAvailable(true)
+
+	assert.Nil(t, client.Ping(context.Background()))
+}
+
+func TestAgentExec(t *testing.T) {
+	agent, client := listen(t)
+
+	agent.SetProgram("/bin/cat", func(args []string, input []byte) ([]byte, []byte, int) {
+		return input, []byte(strings.Join(args, " ")), 3
+	})
+
+	ctx := context.Background()
+
+	pid, err := client.Exec(ctx, "/bin/cat", []string{"-u", "-"}, nil, []byte("hello"))
+	require.Nil(t, err)
+
+	status, err := client.ExecStatus(ctx, pid)
+	require.Nil(t, err)
+	assert.True(t, status.Exited)
+	assert.Equal(t, status.ExitCode, 3)
+
+	stdout, err := status.Stdout()
+	assert.Nil(t, err)
+	assert.Equal(t, string(stdout), "hello")
+
+	stderr, err := status.Stderr()
+	assert.Nil(t, err)
+	assert.Equal(t, string(stderr), "-u -")
+
+	_, err = client.Run(ctx, "/bin/missing")
+
+	agentErr, ok := err.(*guestagent.Error)
+	require.True(t, ok)
+	assert.Equal(t, agentErr.Command, "guest-exec")
+	assert.Contains(t, agentErr.Desc, "No such file or directory")
+}
+
+func TestAgentFiles(t *testing.T) {
+	agent, client := listen(t)
+
+	ctx := context.Background()
+
+	agent.SetFile("/etc/hostname", []byte("vm1\n"))
+
+	content, err := client.ReadFile(ctx, "/etc/hostname")
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), "vm1\n")
+
+	assert.Nil(t, client.WriteFile(ctx, "/etc/hostname", []byte("vm2\n")))
+
+	content, ok := agent.File("/etc/hostname")
+	assert.True(t, ok)
+	assert.Equal(t, string(content), "vm2\n")
+
+	handle, err := client.FileOpen(ctx, "/etc/hostname", "a")
+	require.Nil(t, err)
+
+	n, err := client.FileWrite(ctx, handle, []byte("vm3\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, n, 4)
+	assert.Nil(t, client.FileClose(ctx, handle))
+
+	content, _ = agent.File("/etc/hostname")
+	assert.Equal(t, string(content), "vm2\nvm3\n")
+
+	_, err = client.ReadFile(ctx, "/missing")
+	assert.NotNil(t, err)
+}
+
+func TestAgentInterfaces(t *testing.T) {
+	agent, client := listen(t)
+
+	agent.AddInterface(guestagent.Interface{
+		Name:            "eth0",
+		HardwareAddress: "00:f0:00:00:00:01",
+		IPAddresses:     []guestagent.IPAddress{{Type: "ipv4", Address: "10.0.2.15", Prefix: 24}},
+	})
+
+	interfaces, err := client.NetworkGetInterfaces(context.Background())
+	require.Nil(t, err)
+	require.Len(t, interfaces, 2)
+	assert.Equal(t, interfaces[0].Name, "lo")
+	assert.Equal(t, interfaces[1].HardwareAddress, "00:f0:00:00:00:01")
+	assert.Equal(t, interfaces[1].IPAddresses[0].Address, "10.0.2.15")
+}
+
+func TestAgentFSFreeze(t *testing.T) {
+	agent, client := listen(t)
+
+	ctx := context.Background()
+
+	count, err := client.FSFreeze(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, count, FAKE_FILESYSTEMS)
+	assert.True(t, agent.Frozen())
+
+	status, err := client.FSFreezeStatus(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, status, "frozen")
+
+	// Disabled while frozen
+	_, err = client.ReadFile(ctx, "/etc/hostname")
+	assert.NotNil(t, err)
+	assert.Nil(t, client.Ping(ctx))
+
+	count, err = client.FSThaw(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, count, FAKE_FILESYSTEMS)
+
+	status, err = client.FSFreezeStatus(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, status, "thawed")
+}
+
+func TestAgentShutdown(t *testing.T) {
+	agent, client := listen(t)
+
+	done := make(chan bool, 1)
+
+	agent.After("guest-shutdown", func() {
+		done <- true
+	})
+
+	ctx := context.Background()
+
+	assert.Nil(t, client.Shutdown(ctx, "powerdown"))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		assert.Fail(t, "guest-shutdown not received")
+	}
+
+	// Resynchronized after the command without reply
+	assert.Nil(t, client.Ping(ctx))
+
+	commands := agent.Commands()
+	require.Len(t, commands, 2)
+	assert.JSONEq(t, string(commands[0].Arguments), `{"mode": "powerdown"}`)
+}
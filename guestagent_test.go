@@ -0,0 +1,115 @@
+package vm
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bytearena/schnapps/guestagent"
+	"github.com/bytearena/schnapps/launcher/launchertest"
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuestAgent(t *testing.T) {
+	l := &launchertest.Launcher{}
+	vm := newFakeVM(t, types.VMConfig{}, l)
+
+	_, err := vm.GuestAgent(context.Background())
+	assert.NotNil(t, err)
+
+	require.Nil(t, vm.Start())
+
+	process := l.Processes()[0]
+	socket := process.Config.GuestAgent.Socket
+	assert.Equal(t, socket, filepath.Join(vm.WorkDir(), "qga.sock"))
+
+	agent := process.GuestAgent()
+	agent.AddInterface(guestagent.Interface{
+		Name:            "eth0",
+		HardwareAddress: "00:f0:00:00:00:01",
+		IPAddresses: []guestagent.IPAddress{
+			{Type: "ipv4", Address: "10.0.2.15", Prefix: 24},
+			{Type: "ipv6", Address: "fe80::2f0:ff:fe00:1", Prefix: 64},
+			{Type: "ipv6", Address: "fd00::15", Prefix: 64},
+		},
+	})
+	agent.SetProgram("/bin/hostname", func(args []string, input []byte) ([]byte, []byte, int) {
+		return []byte("vm1\n"), nil, 0
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	ips, err := vm.GuestIPs(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, ips, []net.IP{net.ParseIP("10.0.2.15"), net.ParseIP("fd00::15")})
+
+	status, err := vm.GuestExec(ctx, "/bin/hostname")
+	assert.Nil(t, err)
+	assert.Equal(t, status.ExitCode, 0)
+
+	stdout, _ := status.Stdout()
+	assert.Equal(t, string(stdout), "vm1\n")
+
+	client, err := vm.GuestAgent(ctx)
+	require.Nil(t, err)
+
+	// The guest powers itself down
+	assert.Nil(t, client.Shutdown(ctx, "powerdown"))
+	assert.Nil(t, vm.WaitContext(ctx))
+
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = vm.GuestAgent(ctx)
+	assert.NotNil(t, err)
+}
+
+func TestGuestAgentBoot(t *testing.T) {
+	defer func(timeout time.Duration) { GUEST_AGENT_PING_TIMEOUT = timeout }(GUEST_AGENT_PING_TIMEOUT)
+	GUEST_AGENT_PING_TIMEOUT = 10 * time.Millisecond
+
+	l := &launchertest.Launcher{NoGuestAgent: true}
+	vm := newFakeVM(t, types.VMConfig{
+		Boot: types.BootCheck{GuestAgent: true, PollInterval: time.Millisecond},
+	}, l)
+
+	require.Nil(t, vm.Start())
+	defer vm.Quit()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, ok := vm.WaitUntilBootedContext(ctx).(*BootTimeoutError)
+	assert.True(t, ok)
+
+	// qemu-ga started
+	l.Processes()[0].GuestAgent().SetAvailable(true)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.Nil(t, vm.WaitUntilBootedContext(ctx))
+}
+
+func TestGuestAgentDisabled(t *testing.T) {
+	l := &launchertest.Launcher{}
+	vm := newFakeVM(t, types.VMConfig{
+		Boot: types.BootCheck{GuestAgent: true},
+	}, l)
+	vm.Config.GuestAgent = nil
+
+	require.Nil(t, vm.Start())
+	defer vm.Quit()
+
+	assert.Nil(t, l.Processes()[0].GuestAgent())
+
+	_, err := vm.GuestAgent(context.Background())
+	assert.Equal(t, err, ErrNoGuestAgent)
+	assert.Equal(t, vm.WaitUntilBooted(), ErrNoGuestAgent)
+}
@@ -27,6 +27,7 @@ func GenerateRandomMAC() string {
 	return fmt.Sprintf("00:f0:%s:%s:%s:%s", RandomHex(2), RandomHex(2), RandomHex(2), RandomHex(2))
 }
 
+// MAC of the first bridge NIC of the VM
 func GetVMMAC(vm *vm.VM) (mac string, found bool) {
 	if vm == nil {
 		return "", false
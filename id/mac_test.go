@@ -12,7 +12,7 @@ func TestGetVMMac(t *testing.T) {
 	value := "foo"
 
 	config := types.VMConfig{
-		NICs: []interface{}{
+		NICs: []types.NIC{
 			types.NICBridge{
 				Bridge: "br",
 				MAC:    value,
@@ -33,9 +33,25 @@ func TestGetVMMac(t *testing.T) {
 	assert.Equal(t, mac, value)
 }
 
+func TestGetVMMacFirstBridge(t *testing.T) {
+	config := types.VMConfig{
+		NICs: []types.NIC{
+			types.NICUser{},
+			types.NICTap{Ifname: "tap0", MAC: "foo"},
+			types.NICBridge{Bridge: "br", MAC: "bar"},
+		},
+		Id: 1,
+	}
+
+	mac, hasMac := GetVMMAC(vm.NewVM(config))
+
+	assert.True(t, hasMac)
+	assert.Equal(t, mac, "bar")
+}
+
 func TestGetVMMacNoNics(t *testing.T) {
 	config := types.VMConfig{
-		NICs:          []interface{}{},
+		NICs:          []types.NIC{},
 		Id:            1,
 		MegMemory:     1,
 		CPUAmount:     1,
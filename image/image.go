@@ -0,0 +1,244 @@
+// Package image manages qcow2 overlays backed by base images, to provision
+// many VMs from one image without copying it.
+package image
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	QEMU_IMG = "qemu-img"
+)
+
+// Creates a qcow2 overlay backed by the base image, the base image is never
+// written to.
+func CreateOverlay(base, baseFormat, overlay string) error {
+	base, err := filepath.Abs(base)
+
+	if err != nil {
+		return err
+	}
+
+	if baseFormat == "" {
+		baseFormat = "raw"
+	}
+
+	cmd := exec.Command(QEMU_IMG, "create", "-f", "qcow2", "-b", base, "-F", baseFormat, overlay)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Could not create the overlay of %s: %v: %s", base, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// Stores the overlays of each VM in its own directory (vm-<id>) of a root
+// directory.
+type Manager struct {
+	dir string
+
+	mutex sync.Mutex
+	// Overlays of the VMs whose directory is in use, even without overlays
+	overlays map[int][]string
+}
+
+// Opens the root directory, creating it if needed. The directories left by
+// a previous run are garbage collected, the retained ones are kept.
+func NewManager(dir string) (*Manager, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		dir:      dir,
+		overlays: make(map[int][]string),
+	}
+
+	if _, err := m.GC(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Directory of the VM, it's also used as the work directory of the VM
+func (m *Manager) Dir(id int) string {
+	return filepath.Join(m.dir, "vm-"+strconv.Itoa(id))
+}
+
+// Creates the directory of the VM if needed and tracks it, GC leaves it alone
+// until Remove or Retain.
+func (m *Manager) Open(id int) (string, error) {
+	if err := os.MkdirAll(m.Dir(id), 0755); err != nil {
+		return "", err
+	}
+
+	m.mutex.Lock()
+	if _, tracked := m.overlays[id]; !tracked {
+		m.overlays[id] = []string{}
+	}
+	m.mutex.Unlock()
+
+	return m.Dir(id), nil
+}
+
+// Creates the overlay name.qcow2 of the base image for the VM and returns its
+// path.
+func (m *Manager) Create(id int, name, base, baseFormat string) (string, error) {
+	if _, err := m.Open(id); err != nil {
+		return "", err
+	}
+
+	overlay := filepath.Join(m.Dir(id), name+".qcow2")
+
+	if err := CreateOverlay(base, baseFormat, overlay); err != nil {
+		return "", err
+	}
+
+	m.mutex.Lock()
+	m.overlays[id] = append(m.overlays[id], overlay)
+	m.mutex.Unlock()
+
+	return overlay, nil
+}
+
+// Overlays of the VM, in creation order
+func (m *Manager) Overlays(id int) []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]string{}, m.overlays[id]...)
+}
+
+// Ids of the VMs whose directory is tracked
+func (m *Manager) VMs() []int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ids := make([]int, 0, len(m.overlays))
+
+	for id := range m.overlays {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+// Removes the directory of the VM
+func (m *Manager) Remove(id int) error {
+	m.mutex.Lock()
+	delete(m.overlays, id)
+	m.mutex.Unlock()
+
+	return os.RemoveAll(m.Dir(id))
+}
+
+// Stops tracking the directory of the VM but keeps it on disk, renamed to
+// vm-<id>.retained-<timestamp> so that the next VM with the same id starts
+// from a new directory. Returns the new path. Retained directories are
+// never removed by the manager.
+func (m *Manager) Retain(id int) (string, error) {
+	m.mutex.Lock()
+	delete(m.overlays, id)
+	m.mutex.Unlock()
+
+	retained := m.Dir(id) + ".retained-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	if err := os.Rename(m.Dir(id), retained); err != nil {
+		return "", err
+	}
+
+	return retained, nil
+}
+
+// Removes the directories of the VMs that are not tracked by the manager,
+// and returns their ids. Retained directories are kept.
+func (m *Manager) GC() ([]int, error) {
+	entries, err := ioutil.ReadDir(m.dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	removed := []int{}
+
+	for _, entry := range entries {
+		id, ok := parseDirName(entry)
+
+		if !ok {
+			continue
+		}
+
+		if _, tracked := m.overlays[id]; tracked {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(m.dir, entry.Name())); err != nil {
+			return removed, err
+		}
+
+		removed = append(removed, id)
+	}
+
+	return removed, nil
+}
+
+// Space used on the host by the overlays of the VM, in bytes
+func (m *Manager) Usage(id int) (int64, error) {
+	return diskUsage(m.Dir(id))
+}
+
+// Space used on the host by every overlay, in bytes
+func (m *Manager) TotalUsage() (int64, error) {
+	return diskUsage(m.dir)
+}
+
+func parseDirName(entry os.FileInfo) (int, bool) {
+	if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "vm-") {
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "vm-"))
+
+	return id, err == nil
+}
+
+// Allocated blocks, overlays are sparse and only grow with the guest writes
+func diskUsage(dir string) (int64, error) {
+	var usage int64
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			usage += stat.Blocks * 512
+		} else {
+			usage += info.Size()
+		}
+
+		return nil
+	})
+
+	return usage, err
+}
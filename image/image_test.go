@@ -0,0 +1,135 @@
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytearena/schnapps/image/imagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager(t *testing.T) {
+	dir, restore, err := imagetest.FakeQemuImg(&QEMU_IMG)
+	require.Nil(t, err)
+	defer restore()
+
+	m, err := NewManager(filepath.Join(dir, "overlays"))
+	require.Nil(t, err)
+
+	overlay, err := m.Create(1, "disk0", "/images/linuxkit.raw", "raw")
+	assert.Nil(t, err)
+	assert.Equal(t, overlay, filepath.Join(dir, "overlays", "vm-1", "disk0.qcow2"))
+	assert.FileExists(t, overlay)
+
+	_, err = m.Create(1, "disk1", "/images/assets.qcow2", "qcow2")
+	assert.Nil(t, err)
+	_, err = m.Create(2, "disk0", "/images/linuxkit.raw", "raw")
+	assert.Nil(t, err)
+
+	assert.Equal(t, m.VMs(), []int{1, 2})
+	assert.Len(t, m.Overlays(1), 2)
+
+	usage, err := m.Usage(1)
+	assert.Nil(t, err)
+	assert.True(t, usage >= 2*4096)
+
+	total, err := m.TotalUsage()
+	assert.Nil(t, err)
+	assert.True(t, total >= usage+4096)
+
+	assert.Nil(t, m.Remove(1))
+	assert.Equal(t, m.VMs(), []int{2})
+
+	usage, err = m.Usage(1)
+	assert.Nil(t, err)
+	assert.Equal(t, usage, int64(0))
+}
+
+func TestManagerGC(t *testing.T) {
+	dir, restore, err := imagetest.FakeQemuImg(&QEMU_IMG)
+	require.Nil(t, err)
+	defer restore()
+
+	root := filepath.Join(dir, "overlays")
+
+	m, err := NewManager(root)
+	require.Nil(t, err)
+
+	_, err = m.Create(1, "disk0", "/images/linuxkit.raw", "raw")
+	assert.Nil(t, err)
+	_, err = m.Create(2, "disk0", "/images/linuxkit.raw", "raw")
+	assert.Nil(t, err)
+
+	// A work directory without overlays
+	_, err = m.Open(4)
+	assert.Nil(t, err)
+
+	// Kept on purpose
+	_, err = m.Create(5, "disk0", "/images/linuxkit.raw", "raw")
+	assert.Nil(t, err)
+	retained, err := m.Retain(5)
+	assert.Nil(t, err)
+	assert.FileExists(t, filepath.Join(retained, "disk0.qcow2"))
+	assert.Equal(t, m.VMs(), []int{1, 2, 4})
+
+	// Left by another process
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "vm-3"), 0755))
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "unrelated"), 0755))
+
+	removed, err := m.GC()
+	assert.Nil(t, err)
+	assert.Equal(t, removed, []int{3})
+	assert.DirExists(t, m.Dir(1))
+	assert.DirExists(t, m.Dir(4))
+
+	// A new manager starts from scratch
+	_, err = NewManager(root)
+	assert.Nil(t, err)
+
+	_, err = os.Stat(m.Dir(1))
+	assert.True(t, os.IsNotExist(err))
+	assert.DirExists(t, retained)
+	assert.DirExists(t, filepath.Join(root, "unrelated"))
+}
+
+func TestManagerRetainReuse(t *testing.T) {
+	dir, restore, err := imagetest.FakeQemuImg(&QEMU_IMG)
+	require.Nil(t, err)
+	defer restore()
+
+	m, err := NewManager(filepath.Join(dir, "overlays"))
+	require.Nil(t, err)
+
+	_, err = m.Create(7, "disk0", "/images/linuxkit.raw", "raw")
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(m.Dir(7), "evidence"), []byte("crash"), 0644))
+
+	retained, err := m.Retain(7)
+	require.Nil(t, err)
+
+	// The next VM with the same id starts from an empty directory
+	_, err = m.Open(7)
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(m.Dir(7), "evidence"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, m.Remove(7))
+
+	content, err := ioutil.ReadFile(filepath.Join(retained, "evidence"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), "crash")
+}
+
+func TestCreateOverlayError(t *testing.T) {
+	dir, restore, err := imagetest.FakeQemuImg(&QEMU_IMG)
+	require.Nil(t, err)
+	defer restore()
+
+	QEMU_IMG = filepath.Join(dir, "missing")
+
+	err = CreateOverlay("/images/linuxkit.raw", "raw", filepath.Join(dir, "overlay.qcow2"))
+	assert.NotNil(t, err)
+}
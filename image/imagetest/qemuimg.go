@@ -0,0 +1,37 @@
+// Package imagetest fakes qemu-img, to test the overlays without QEMU.
+package imagetest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Points qemuImg (image.QEMU_IMG) to a script in a new temporary directory.
+// The script records its arguments in the args file of the directory and
+// creates a 4KiB overlay. restore puts qemuImg back and removes the directory.
+func FakeQemuImg(qemuImg *string) (dir string, restore func(), err error) {
+	dir, err = ioutil.TempDir("", "qemu-img")
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	script := `#!/bin/sh
+echo "$@" > ` + filepath.Join(dir, "args") + `
+for last; do true; done
+head -c 4096 /dev/zero > "$last"
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "qemu-img"), []byte(script), 0755); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	previous := *qemuImg
+	*qemuImg = filepath.Join(dir, "qemu-img")
+
+	return dir, func() {
+		*qemuImg = previous
+		os.RemoveAll(dir)
+	}, nil
+}
@@ -0,0 +1,274 @@
+package launcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/bytearena/schnapps/cli"
+	"github.com/bytearena/schnapps/types"
+)
+
+var (
+	// Device used to detect whether KVM is available
+	KVM_DEVICE = "/dev/kvm"
+
+	// QEMU targets KVM can run, by host architecture (runtime.GOARCH). The
+	// first one is the native target.
+	KVM_TARGETS = map[string][]string{
+		"amd64":   {"x86_64", "i386"},
+		"386":     {"i386"},
+		"arm64":   {"aarch64"},
+		"ppc64le": {"ppc64"},
+		"ppc64":   {"ppc64"},
+		"s390x":   {"s390x"},
+		"riscv64": {"riscv64"},
+	}
+
+	// Binaries looked up in the $PATH when the config doesn't set one, in
+	// order of preference. The kvm wrapper forces KVM, it can't run TCG.
+	DEFAULT_BINARIES = map[types.Accelerator][]string{
+		types.AcceleratorKVM: {"kvm", "qemu-system-" + hostTarget()},
+		types.AcceleratorTCG: {"qemu-system-" + hostTarget()},
+	}
+
+	ErrKVMNotFound        = errors.New("QEMU binary not found")
+	ErrKVMUnavailable     = errors.New("KVM is not available")
+	ErrUnknownAccelerator = errors.New("Unknown accelerator")
+	ErrProcessStart       = errors.New("Could not start the KVM process")
+)
+
+// Running emulator process
+type Process interface {
+	// Input of the serial console
+	Stdin() io.WriteCloser
+	Stdout() io.ReadCloser
+	Stderr() io.ReadCloser
+
+	Signal(sig os.Signal) error
+	Kill() error
+
+	// Blocks until the process has exited. Returns its exit code (-1 if it
+	// was terminated by a signal) and an error if it didn't exit cleanly.
+	Wait() (int, error)
+
+	Release() error
+}
+
+// Starts the emulator process of a VM
+type Launcher interface {
+	Launch(config types.VMConfig) (Process, error)
+}
+
+// Whether /dev/kvm exists and can be opened by the current user
+func KVMAvailable() bool {
+	f, err := os.OpenFile(KVM_DEVICE, os.O_RDWR, 0)
+
+	if err != nil {
+		return false
+	}
+
+	f.Close()
+
+	return true
+}
+
+// Returns the accelerator to run the binary with (the default binary if
+// empty), auto is resolved to KVM if it is available and the binary emulates
+// the host architecture, TCG otherwise.
+func ResolveAccelerator(accel types.Accelerator, binary string) (types.Accelerator, error) {
+	switch accel {
+	case "", types.AcceleratorAuto:
+		if KVMAvailable() && isKVMTarget(binary) {
+			return types.AcceleratorKVM, nil
+		}
+
+		return types.AcceleratorTCG, nil
+
+	case types.AcceleratorKVM:
+		if !KVMAvailable() {
+			return "", fmt.Errorf("%w: could not open %s", ErrKVMUnavailable, KVM_DEVICE)
+		}
+
+		return accel, nil
+
+	case types.AcceleratorTCG:
+		return accel, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnknownAccelerator, accel)
+}
+
+func hostTarget() string {
+	if targets := KVM_TARGETS[runtime.GOARCH]; len(targets) > 0 {
+		return targets[0]
+	}
+
+	return "x86_64"
+}
+
+// qemu-system-<target> binaries are checked against the host architecture,
+// other names (kvm, qemu-kvm) are wrappers running the native target.
+func isKVMTarget(binary string) bool {
+	name := filepath.Base(binary)
+
+	if !strings.HasPrefix(name, "qemu-system-") {
+		return true
+	}
+
+	target := strings.TrimPrefix(name, "qemu-system-")
+
+	for _, t := range KVM_TARGETS[runtime.GOARCH] {
+		if t == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the path of the emulator binary of the config
+func FindBinary(config types.VMConfig) (string, error) {
+	if config.Binary != "" {
+		path, err := exec.LookPath(config.Binary)
+
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrKVMNotFound, err)
+		}
+
+		return path, nil
+	}
+
+	for _, name := range DEFAULT_BINARIES[config.Accelerator] {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", ErrKVMNotFound
+}
+
+// Implemented by launchers able to probe the capabilities of the emulator
+// before launching it
+type Prober interface {
+	Probe(config types.VMConfig) (*cli.Capabilities, error)
+}
+
+// Runs the emulator binary of the config, kvm from the $PATH by default. The
+// accelerator of the config must be resolved, see ResolveAccelerator.
+type ExecLauncher struct{}
+
+func (l ExecLauncher) Probe(config types.VMConfig) (*cli.Capabilities, error) {
+	kvmbin, err := FindBinary(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return probe(kvmbin)
+}
+
+func (l ExecLauncher) Launch(config types.VMConfig) (Process, error) {
+	kvmbin, err := FindBinary(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	caps, err := probe(kvmbin)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, err := cli.CreateKVMCommand(kvmbin, config, caps)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stdin, err := cmd.StdinPipe()
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProcessStart, err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProcessStart, err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProcessStart, err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProcessStart, err)
+	}
+
+	return &execProcess{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}, nil
+}
+
+func probe(kvmbin string) (*cli.Capabilities, error) {
+	caps, err := cli.Probe(kvmbin)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProcessStart, err)
+	}
+
+	return caps, nil
+}
+
+type execProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr io.ReadCloser
+}
+
+func (p *execProcess) Stdin() io.WriteCloser {
+	return p.stdin
+}
+
+func (p *execProcess) Stdout() io.ReadCloser {
+	return p.stdout
+}
+
+func (p *execProcess) Stderr() io.ReadCloser {
+	return p.stderr
+}
+
+func (p *execProcess) Signal(sig os.Signal) error {
+	return p.cmd.Process.Signal(sig)
+}
+
+func (p *execProcess) Kill() error {
+	return p.cmd.Process.Kill()
+}
+
+func (p *execProcess) Wait() (int, error) {
+	err := p.cmd.Wait()
+
+	if p.cmd.ProcessState == nil {
+		return -1, err
+	}
+
+	return p.cmd.ProcessState.ExitCode(), err
+}
+
+func (p *execProcess) Release() error {
+	return p.cmd.Process.Release()
+}
@@ -0,0 +1,111 @@
+package launcher
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func withKVMDevice(t *testing.T, available bool) func() {
+	dir, err := ioutil.TempDir("", "launcher")
+	assert.Nil(t, err)
+
+	device := KVM_DEVICE
+	KVM_DEVICE = filepath.Join(dir, "kvm")
+
+	if available {
+		assert.Nil(t, ioutil.WriteFile(KVM_DEVICE, []byte{}, 0600))
+	}
+
+	return func() {
+		KVM_DEVICE = device
+		os.RemoveAll(dir)
+	}
+}
+
+func TestResolveAcceleratorAuto(t *testing.T) {
+	restore := withKVMDevice(t, true)
+
+	accel, err := ResolveAccelerator(types.AcceleratorAuto, "")
+	assert.Nil(t, err)
+	assert.Equal(t, accel, types.AcceleratorKVM)
+
+	restore()
+	restore = withKVMDevice(t, false)
+	defer restore()
+
+	accel, err = ResolveAccelerator("", "")
+	assert.Nil(t, err)
+	assert.Equal(t, accel, types.AcceleratorTCG)
+}
+
+func TestResolveAcceleratorBinary(t *testing.T) {
+	restore := withKVMDevice(t, true)
+	defer restore()
+
+	targets := KVM_TARGETS
+	KVM_TARGETS = map[string][]string{runtime.GOARCH: {"x86_64", "i386"}}
+	defer func() { KVM_TARGETS = targets }()
+
+	kvm := []string{"kvm", "qemu-kvm", "qemu-system-x86_64", "/usr/bin/qemu-system-i386"}
+
+	for _, binary := range kvm {
+		accel, err := ResolveAccelerator(types.AcceleratorAuto, binary)
+		assert.Nil(t, err)
+		assert.Equal(t, accel, types.AcceleratorKVM, binary)
+	}
+
+	// Another architecture is emulated
+	accel, err := ResolveAccelerator(types.AcceleratorAuto, "qemu-system-aarch64")
+	assert.Nil(t, err)
+	assert.Equal(t, accel, types.AcceleratorTCG)
+}
+
+func TestResolveAcceleratorExplicit(t *testing.T) {
+	restore := withKVMDevice(t, false)
+	defer restore()
+
+	_, err := ResolveAccelerator(types.AcceleratorKVM, "")
+	assert.True(t, errors.Is(err, ErrKVMUnavailable))
+
+	accel, err := ResolveAccelerator(types.AcceleratorTCG, "")
+	assert.Nil(t, err)
+	assert.Equal(t, accel, types.AcceleratorTCG)
+
+	_, err = ResolveAccelerator("hvf", "")
+	assert.True(t, errors.Is(err, ErrUnknownAccelerator))
+}
+
+func TestFindBinary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "launcher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	native := "qemu-system-" + hostTarget()
+
+	for _, name := range []string{native, "qemu-system-aarch64"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0755))
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir)
+	defer os.Setenv("PATH", path)
+
+	// The kvm wrapper isn't installed
+	bin, err := FindBinary(types.VMConfig{Accelerator: types.AcceleratorKVM})
+	assert.Nil(t, err)
+	assert.Equal(t, bin, filepath.Join(dir, native))
+
+	bin, err = FindBinary(types.VMConfig{Binary: "qemu-system-aarch64"})
+	assert.Nil(t, err)
+	assert.Equal(t, bin, filepath.Join(dir, "qemu-system-aarch64"))
+
+	_, err = FindBinary(types.VMConfig{Binary: "qemu-system-riscv64"})
+	assert.True(t, errors.Is(err, ErrKVMNotFound))
+}
@@ -0,0 +1,302 @@
+// Package launchertest simulates a QEMU process, to test the VM lifecycle
+// without a kvm binary or /dev/kvm.
+package launchertest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/bytearena/schnapps/guestagent/guestagenttest"
+	"github.com/bytearena/schnapps/launcher"
+	schnappsqmp "github.com/bytearena/schnapps/qmp"
+	"github.com/bytearena/schnapps/qmp/qmptest"
+	"github.com/bytearena/schnapps/types"
+)
+
+var (
+	// Thread id of the first vCPU of the fake processes
+	FAKE_THREAD_ID = 100000
+)
+
+// Launches fake processes. Each one prints Console on its stdout, echoes its
+// stdin, serves QMP on the address of the VM config, serves a guest agent on
+// its socket and exits on quit, like QEMU.
+type Launcher struct {
+	// Lines printed on stdout once launched
+	Console []string
+
+	// The guest ignores ACPI powerdown requests
+	IgnorePowerdown bool
+
+	// The process ignores SIGTERM
+	IgnoreTerm bool
+
+	// The guest doesn't run qemu-ga, see guestagenttest.Agent.SetAvailable
+	NoGuestAgent bool
+
+	// Error returned by Launch
+	Err error
+
+	mutex     sync.Mutex
+	processes []*Process
+}
+
+func (l *Launcher) Launch(config types.VMConfig) (launcher.Process, error) {
+	if l.Err != nil {
+		return nil, l.Err
+	}
+
+	if config.QMPServer == nil {
+		return nil, errors.New("No QMP server configured")
+	}
+
+	server, err := qmptest.Listen(config.QMPServer.Protocol, config.QMPServer.Addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var agent *guestagenttest.Agent
+
+	if config.GuestAgent != nil {
+		agent, err = guestagenttest.Listen(config.GuestAgent.Socket)
+
+		if err != nil {
+			server.Close()
+
+			return nil, err
+		}
+
+		agent.SetAvailable(!l.NoGuestAgent)
+	}
+
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+
+	p := &Process{
+		Config:     config,
+		server:     server,
+		agent:      agent,
+		stdin:      stdinWriter,
+		stdout:     stdoutReader,
+		stderr:     stderrReader,
+		stdoutPipe: stdoutWriter,
+		stderrPipe: stderrWriter,
+		ignoreTerm: l.IgnoreTerm,
+		exited:     make(chan struct{}),
+	}
+
+	cpus := config.CPUAmount
+
+	if cpus < 1 {
+		cpus = 1
+	}
+
+	for i := 0; i < cpus; i++ {
+		p.vcpuThreads = append(p.vcpuThreads, FAKE_THREAD_ID+i)
+	}
+
+	server.Handle("query-cpus-fast", func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+		res := []schnappsqmp.CPUInfoFast{}
+
+		for i, thread := range p.vcpuThreads {
+			res = append(res, schnappsqmp.CPUInfoFast{CPUIndex: i, ThreadId: thread})
+		}
+
+		return res, nil
+	})
+
+	// Display passwords
+	if config.Display != nil {
+		for _, command := range []string{"change-vnc-password", "set_password"} {
+			server.Handle(command, func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+				return nil, nil
+			})
+		}
+	}
+
+	server.After("quit", func() {
+		server.Emit("SHUTDOWN", map[string]interface{}{"guest": false, "reason": "host-qmp-quit"})
+		p.Exit(0)
+	})
+
+	if !l.IgnorePowerdown {
+		server.After("system_powerdown", func() {
+			server.Emit("SHUTDOWN", map[string]interface{}{"guest": true, "reason": "guest-shutdown"})
+			p.Exit(0)
+		})
+
+		if agent != nil {
+			agent.After("guest-shutdown", func() {
+				server.Emit("SHUTDOWN", map[string]interface{}{"guest": true, "reason": "guest-shutdown"})
+				p.Exit(0)
+			})
+		}
+	}
+
+	go func() {
+		for _, line := range l.Console {
+			p.Print(line)
+		}
+	}()
+
+	// Like a terminal
+	go func() {
+		io.Copy(stdoutWriter, stdinReader)
+		stdinReader.Close()
+	}()
+
+	l.mutex.Lock()
+	l.processes = append(l.processes, p)
+	l.mutex.Unlock()
+
+	return p, nil
+}
+
+// Processes launched so far, in order
+func (l *Launcher) Processes() []*Process {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]*Process{}, l.processes...)
+}
+
+type Process struct {
+	Config types.VMConfig
+
+	server      *qmptest.Server
+	agent       *guestagenttest.Agent
+	vcpuThreads []int
+	stdin       *io.PipeWriter
+	stdout      io.ReadCloser
+	stderr      io.ReadCloser
+	stdoutPipe  *io.PipeWriter
+	stderrPipe  *io.PipeWriter
+	ignoreTerm  bool
+
+	exitOnce sync.Once
+	exited   chan struct{}
+	code     int
+	err      error
+	signals  []os.Signal
+	mutex    sync.Mutex
+}
+
+// QMP server of the process, to script responses and emit events
+func (p *Process) QMP() *qmptest.Server {
+	return p.server
+}
+
+// Guest agent of the process, nil if the VM config has none
+func (p *Process) GuestAgent() *guestagenttest.Agent {
+	return p.agent
+}
+
+// Thread ids of the vCPUs reported by query-cpus-fast, they don't exist on
+// the host
+func (p *Process) VCPUThreads() []int {
+	return p.vcpuThreads
+}
+
+// Prints a line on the console (stdout)
+func (p *Process) Print(line string) error {
+	_, err := p.stdoutPipe.Write([]byte(line + "\n"))
+
+	return err
+}
+
+// Simulates the exit of the process with the given code
+func (p *Process) Exit(code int) {
+	if code == 0 {
+		p.exit(0, nil)
+	} else {
+		p.exit(code, errors.New("exit status "+strconv.Itoa(code)))
+	}
+}
+
+// Signals received so far
+func (p *Process) Signals() []os.Signal {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]os.Signal{}, p.signals...)
+}
+
+func (p *Process) Exited() <-chan struct{} {
+	return p.exited
+}
+
+func (p *Process) exit(code int, err error) {
+	p.exitOnce.Do(func() {
+		p.code = code
+		p.err = err
+
+		p.server.Close()
+
+		if p.agent != nil {
+			p.agent.Close()
+		}
+
+		p.stdin.Close()
+		p.stdoutPipe.Close()
+		p.stderrPipe.Close()
+
+		close(p.exited)
+	})
+}
+
+func (p *Process) Stdin() io.WriteCloser {
+	return p.stdin
+}
+
+func (p *Process) Stdout() io.ReadCloser {
+	return p.stdout
+}
+
+func (p *Process) Stderr() io.ReadCloser {
+	return p.stderr
+}
+
+func (p *Process) Signal(sig os.Signal) error {
+	select {
+	case <-p.exited:
+		return errors.New("os: process already finished")
+	default:
+	}
+
+	p.mutex.Lock()
+	p.signals = append(p.signals, sig)
+	p.mutex.Unlock()
+
+	switch sig {
+	case syscall.SIGKILL:
+		p.exit(-1, errors.New("signal: killed"))
+	case syscall.SIGTERM:
+		if !p.ignoreTerm {
+			// QEMU exits cleanly on SIGTERM
+			p.exit(0, nil)
+		}
+	}
+
+	return nil
+}
+
+func (p *Process) Kill() error {
+	return p.Signal(syscall.SIGKILL)
+}
+
+func (p *Process) Wait() (int, error) {
+	<-p.exited
+
+	return p.code, p.err
+}
+
+func (p *Process) Release() error {
+	return nil
+}
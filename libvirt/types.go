@@ -1,3 +1,118 @@
 package libvirt
 
-const EVENT_SHUTDOWN = "SHUTDOWN"
+// QMP event names, see qapi/*.json in the QEMU sources for their payloads.
+const (
+	// Run state
+	EVENT_SHUTDOWN          = "SHUTDOWN"
+	EVENT_POWERDOWN         = "POWERDOWN"
+	EVENT_RESET             = "RESET"
+	EVENT_STOP              = "STOP"
+	EVENT_RESUME            = "RESUME"
+	EVENT_SUSPEND           = "SUSPEND"
+	EVENT_SUSPEND_DISK      = "SUSPEND_DISK"
+	EVENT_WAKEUP            = "WAKEUP"
+	EVENT_WATCHDOG          = "WATCHDOG"
+	EVENT_GUEST_PANICKED    = "GUEST_PANICKED"
+	EVENT_GUEST_CRASHLOADED = "GUEST_CRASHLOADED"
+	EVENT_MEMORY_FAILURE    = "MEMORY_FAILURE"
+
+	// Devices
+	EVENT_DEVICE_DELETED            = "DEVICE_DELETED"
+	EVENT_DEVICE_TRAY_MOVED         = "DEVICE_TRAY_MOVED"
+	EVENT_DEVICE_UNPLUG_GUEST_ERROR = "DEVICE_UNPLUG_GUEST_ERROR"
+	EVENT_NIC_RX_FILTER_CHANGED     = "NIC_RX_FILTER_CHANGED"
+	EVENT_VSERPORT_CHANGE           = "VSERPORT_CHANGE"
+	EVENT_ACPI_DEVICE_OST           = "ACPI_DEVICE_OST"
+	EVENT_BALLOON_CHANGE            = "BALLOON_CHANGE"
+	EVENT_MEMORY_DEVICE_SIZE_CHANGE = "MEMORY_DEVICE_SIZE_CHANGE"
+	EVENT_RTC_CHANGE                = "RTC_CHANGE"
+	EVENT_UNPLUG_PRIMARY            = "UNPLUG_PRIMARY"
+
+	// Block devices and jobs
+	EVENT_BLOCK_IMAGE_CORRUPTED     = "BLOCK_IMAGE_CORRUPTED"
+	EVENT_BLOCK_IO_ERROR            = "BLOCK_IO_ERROR"
+	EVENT_BLOCK_JOB_CANCELLED       = "BLOCK_JOB_CANCELLED"
+	EVENT_BLOCK_JOB_COMPLETED       = "BLOCK_JOB_COMPLETED"
+	EVENT_BLOCK_JOB_ERROR           = "BLOCK_JOB_ERROR"
+	EVENT_BLOCK_JOB_PENDING         = "BLOCK_JOB_PENDING"
+	EVENT_BLOCK_JOB_READY           = "BLOCK_JOB_READY"
+	EVENT_BLOCK_WRITE_THRESHOLD     = "BLOCK_WRITE_THRESHOLD"
+	EVENT_JOB_STATUS_CHANGE         = "JOB_STATUS_CHANGE"
+	EVENT_QUORUM_FAILURE            = "QUORUM_FAILURE"
+	EVENT_QUORUM_REPORT_BAD         = "QUORUM_REPORT_BAD"
+	EVENT_PR_MANAGER_STATUS_CHANGED = "PR_MANAGER_STATUS_CHANGED"
+
+	// Displays
+	EVENT_VNC_CONNECTED           = "VNC_CONNECTED"
+	EVENT_VNC_INITIALIZED         = "VNC_INITIALIZED"
+	EVENT_VNC_DISCONNECTED        = "VNC_DISCONNECTED"
+	EVENT_SPICE_CONNECTED         = "SPICE_CONNECTED"
+	EVENT_SPICE_INITIALIZED       = "SPICE_INITIALIZED"
+	EVENT_SPICE_DISCONNECTED      = "SPICE_DISCONNECTED"
+	EVENT_SPICE_MIGRATE_COMPLETED = "SPICE_MIGRATE_COMPLETED"
+
+	// Migration
+	EVENT_MIGRATION           = "MIGRATION"
+	EVENT_MIGRATION_PASS      = "MIGRATION_PASS"
+	EVENT_COLO_EXIT           = "COLO_EXIT"
+	EVENT_FAILOVER_NEGOTIATED = "FAILOVER_NEGOTIATED"
+
+	// Misc
+	EVENT_DUMP_COMPLETED          = "DUMP_COMPLETED"
+	EVENT_RDMA_GID_STATUS_CHANGED = "RDMA_GID_STATUS_CHANGED"
+)
+
+var EVENTS = []string{
+	EVENT_SHUTDOWN,
+	EVENT_POWERDOWN,
+	EVENT_RESET,
+	EVENT_STOP,
+	EVENT_RESUME,
+	EVENT_SUSPEND,
+	EVENT_SUSPEND_DISK,
+	EVENT_WAKEUP,
+	EVENT_WATCHDOG,
+	EVENT_GUEST_PANICKED,
+	EVENT_GUEST_CRASHLOADED,
+	EVENT_MEMORY_FAILURE,
+
+	EVENT_DEVICE_DELETED,
+	EVENT_DEVICE_TRAY_MOVED,
+	EVENT_DEVICE_UNPLUG_GUEST_ERROR,
+	EVENT_NIC_RX_FILTER_CHANGED,
+	EVENT_VSERPORT_CHANGE,
+	EVENT_ACPI_DEVICE_OST,
+	EVENT_BALLOON_CHANGE,
+	EVENT_MEMORY_DEVICE_SIZE_CHANGE,
+	EVENT_RTC_CHANGE,
+	EVENT_UNPLUG_PRIMARY,
+
+	EVENT_BLOCK_IMAGE_CORRUPTED,
+	EVENT_BLOCK_IO_ERROR,
+	EVENT_BLOCK_JOB_CANCELLED,
+	EVENT_BLOCK_JOB_COMPLETED,
+	EVENT_BLOCK_JOB_ERROR,
+	EVENT_BLOCK_JOB_PENDING,
+	EVENT_BLOCK_JOB_READY,
+	EVENT_BLOCK_WRITE_THRESHOLD,
+	EVENT_JOB_STATUS_CHANGE,
+	EVENT_QUORUM_FAILURE,
+	EVENT_QUORUM_REPORT_BAD,
+	EVENT_PR_MANAGER_STATUS_CHANGED,
+
+	EVENT_VNC_CONNECTED,
+	EVENT_VNC_INITIALIZED,
+	EVENT_VNC_DISCONNECTED,
+	EVENT_SPICE_CONNECTED,
+	EVENT_SPICE_INITIALIZED,
+	EVENT_SPICE_DISCONNECTED,
+	EVENT_SPICE_MIGRATE_COMPLETED,
+
+	EVENT_MIGRATION,
+	EVENT_MIGRATION_PASS,
+	EVENT_COLO_EXIT,
+	EVENT_FAILOVER_NEGOTIATED,
+
+	EVENT_DUMP_COMPLETED,
+	EVENT_RDMA_GID_STATUS_CHANGED,
+}
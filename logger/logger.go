@@ -0,0 +1,194 @@
+// Package logger defines the structured logger used by the VM, the scheduler
+// and the servers. It's a subset of *slog.Logger, which can be used as is.
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Keys of the structured fields
+const (
+	KEY_VM_ID    = "vm_id"
+	KEY_MAC      = "mac"
+	KEY_QMP_ADDR = "qmp_addr"
+	KEY_EVENT    = "event"
+	KEY_ERROR    = "error"
+)
+
+// The arguments are alternating keys and values, like log/slog
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+var (
+	defaultMutex  sync.Mutex
+	defaultLogger Logger = NewText(os.Stdout, LevelInfo)
+)
+
+// Used by the components without a logger of their own, a text logger on
+// stdout by default
+func Default() Logger {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	return defaultLogger
+}
+
+func SetDefault(l Logger) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	defaultLogger = l
+}
+
+// Logger, or the default logger if nil
+func OrDefault(l Logger) Logger {
+	if l == nil {
+		return Default()
+	}
+
+	return l
+}
+
+// Writes one line per record, in the format of the slog text handler
+// without the time: level=INFO msg=Starting... vm_id=1
+type Text struct {
+	level Level
+
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+// Logs the records of the given level and above
+func NewText(w io.Writer, level Level) *Text {
+	return &Text{w: w, level: level}
+}
+
+func (t *Text) Debug(msg string, args ...interface{}) {
+	t.log(LevelDebug, msg, args)
+}
+
+func (t *Text) Info(msg string, args ...interface{}) {
+	t.log(LevelInfo, msg, args)
+}
+
+func (t *Text) Warn(msg string, args ...interface{}) {
+	t.log(LevelWarn, msg, args)
+}
+
+func (t *Text) Error(msg string, args ...interface{}) {
+	t.log(LevelError, msg, args)
+}
+
+func (t *Text) log(level Level, msg string, args []interface{}) {
+	if level < t.level {
+		return
+	}
+
+	var line strings.Builder
+
+	line.WriteString("level=" + level.String() + " msg=" + quote(msg))
+
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+
+		// Like slog, a value without key
+		if !ok || i+1 == len(args) {
+			line.WriteString(" !BADKEY=" + quote(fmt.Sprint(args[i])))
+			i--
+
+			continue
+		}
+
+		line.WriteString(" " + key + "=" + quote(fmt.Sprint(args[i+1])))
+	}
+
+	line.WriteString("\n")
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	io.WriteString(t.w, line.String())
+}
+
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// Drops every record
+type Discard struct{}
+
+func (Discard) Debug(msg string, args ...interface{}) {}
+func (Discard) Info(msg string, args ...interface{})  {}
+func (Discard) Warn(msg string, args ...interface{})  {}
+func (Discard) Error(msg string, args ...interface{}) {}
+
+// Adds the fields to each record of the logger, like slog.Logger.With
+func With(l Logger, args ...interface{}) Logger {
+	if len(args) == 0 {
+		return l
+	}
+
+	return &withFields{logger: l, fields: args}
+}
+
+type withFields struct {
+	logger Logger
+	fields []interface{}
+}
+
+func (w *withFields) Debug(msg string, args ...interface{}) {
+	w.logger.Debug(msg, w.args(args)...)
+}
+
+func (w *withFields) Info(msg string, args ...interface{}) {
+	w.logger.Info(msg, w.args(args)...)
+}
+
+func (w *withFields) Warn(msg string, args ...interface{}) {
+	w.logger.Warn(msg, w.args(args)...)
+}
+
+func (w *withFields) Error(msg string, args ...interface{}) {
+	w.logger.Error(msg, w.args(args)...)
+}
+
+func (w *withFields) args(args []interface{}) []interface{} {
+	return append(append([]interface{}{}, w.fields...), args...)
+}
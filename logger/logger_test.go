@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestText(t *testing.T) {
+	var buf bytes.Buffer
+
+	l := NewText(&buf, LevelInfo)
+
+	l.Debug("Hidden")
+	l.Info("Starting...", KEY_VM_ID, 1, KEY_QMP_ADDR, "localhost:4444")
+	l.Warn("Could not close stdout", KEY_ERROR, errors.New("file already closed"))
+	l.Error("Odd", 42, "value", "key")
+
+	assert.Equal(t, buf.String(), `level=INFO msg=Starting... vm_id=1 qmp_addr=localhost:4444
+level=WARN msg="Could not close stdout" error="file already closed"
+level=ERROR msg=Odd !BADKEY=42 value=key
+`)
+}
+
+func TestWith(t *testing.T) {
+	var buf bytes.Buffer
+
+	l := With(NewText(&buf, LevelDebug), KEY_VM_ID, 1)
+	l.Debug("Received event", KEY_EVENT, "STOP")
+
+	assert.Equal(t, buf.String(), "level=DEBUG msg=\"Received event\" vm_id=1 event=STOP\n")
+}
+
+func TestDefault(t *testing.T) {
+	previous := Default()
+	defer SetDefault(previous)
+
+	SetDefault(Discard{})
+	assert.Equal(t, OrDefault(nil), Discard{})
+
+	var buf bytes.Buffer
+	assert.Equal(t, OrDefault(NewText(&buf, LevelInfo)), NewText(&buf, LevelInfo))
+}
+
+func TestSlog(t *testing.T) {
+	var buf bytes.Buffer
+
+	var l Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+
+			return a
+		},
+	}))
+
+	With(l, KEY_VM_ID, 1).Info("Starting...", KEY_MAC, "00:f0:00:00:00:01")
+
+	assert.Equal(t, buf.String(), "level=INFO msg=Starting... vm_id=1 mac=00:f0:00:00:00:01\n")
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/bytearena/schnapps"
+	"github.com/bytearena/schnapps/logger"
 	"github.com/bytearena/schnapps/types"
 )
 
@@ -13,6 +14,7 @@ type RetrieveVMFn func(id string) *vm.VM
 type MetadataHTTPServer struct {
 	addr         string
 	retrieveVMFn RetrieveVMFn
+	log          logger.Logger
 }
 
 func vmMetadataToString(metadata types.VMMetadata) string {
@@ -31,11 +33,14 @@ func (server *MetadataHTTPServer) handleMetadataRequest(w http.ResponseWriter, r
 	id, hasId := r.Form["id"]
 
 	if !hasId {
+		logger.OrDefault(server.log).Warn("Metadata request without id", "remote_addr", r.RemoteAddr)
 		return
 	}
 
 	vm := server.retrieveVMFn(id[0])
 
+	logger.OrDefault(server.log).Debug("Metadata request", logger.KEY_VM_ID, id[0], "found", vm != nil)
+
 	if vm != nil {
 		fmt.Fprintf(w, vmMetadataToString(vm.Config.Metadata))
 	} else {
@@ -43,9 +48,16 @@ func (server *MetadataHTTPServer) handleMetadataRequest(w http.ResponseWriter, r
 	}
 }
 
+// logger.Default() is used if no logger is set. Must be called before Start.
+func (server *MetadataHTTPServer) SetLogger(l logger.Logger) {
+	server.log = l
+}
+
 func (server *MetadataHTTPServer) Start() error {
 	http.HandleFunc("/metadata", server.handleMetadataRequest)
 
+	logger.OrDefault(server.log).Info("Starting metadata server", "addr", server.addr)
+
 	return http.ListenAndServe(server.addr, nil)
 }
 
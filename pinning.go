@@ -0,0 +1,67 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Sets the CPU affinity of a host thread
+var setAffinity = schedSetaffinity
+
+// Host thread id of each vCPU, by index
+func (vm *VM) VCPUThreads(ctx context.Context) (map[int]int, error) {
+	threads := make(map[int]int)
+
+	if !vm.capabilities.HasCommand("query-cpus-fast") {
+		cpus, err := vm.qmp.QueryCPUs(ctx)
+
+		for _, cpu := range cpus {
+			threads[cpu.CPU] = cpu.ThreadId
+		}
+
+		return threads, err
+	}
+
+	cpus, err := vm.qmp.QueryCPUsFast(ctx)
+
+	for _, cpu := range cpus {
+		threads[cpu.CPUIndex] = cpu.ThreadId
+	}
+
+	return threads, err
+}
+
+func (vm *VM) pinCPUs(ctx context.Context) error {
+	if len(vm.Config.CPUPinning) == 0 {
+		return nil
+	}
+
+	threads, err := vm.VCPUThreads(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Could not pin the vCPUs: %v", err)
+	}
+
+	vcpus := make([]int, 0, len(vm.Config.CPUPinning))
+
+	for vcpu := range vm.Config.CPUPinning {
+		vcpus = append(vcpus, vcpu)
+	}
+
+	sort.Ints(vcpus)
+
+	for _, vcpu := range vcpus {
+		thread, ok := threads[vcpu]
+
+		if !ok {
+			return fmt.Errorf("Could not pin vCPU %d: vCPU not found", vcpu)
+		}
+
+		if err := setAffinity(thread, vm.Config.CPUPinning[vcpu]); err != nil {
+			return fmt.Errorf("Could not pin vCPU %d: %v", vcpu, err)
+		}
+	}
+
+	return nil
+}
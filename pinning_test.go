@@ -0,0 +1,81 @@
+package vm
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/bytearena/schnapps/launcher/launchertest"
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Records the affinities instead of setting them
+func withFakeAffinity(err error) (affinities map[int][]int, restore func()) {
+	var mutex sync.Mutex
+	affinities = make(map[int][]int)
+
+	previous := setAffinity
+	setAffinity = func(tid int, cpus []int) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		affinities[tid] = cpus
+
+		return err
+	}
+
+	return affinities, func() {
+		setAffinity = previous
+	}
+}
+
+func TestPinCPUs(t *testing.T) {
+	affinities, restore := withFakeAffinity(nil)
+	defer restore()
+
+	l := &launchertest.Launcher{}
+	vm := newFakeVM(t, types.VMConfig{
+		CPUAmount:  4,
+		CPUPinning: map[int][]int{0: {2}, 3: {6, 7}},
+	}, l)
+
+	require.Nil(t, vm.Start())
+	defer vm.Quit()
+
+	threads := l.Processes()[0].VCPUThreads()
+
+	assert.Equal(t, affinities, map[int][]int{
+		threads[0]: {2},
+		threads[3]: {6, 7},
+	})
+}
+
+func TestPinCPUsError(t *testing.T) {
+	_, restore := withFakeAffinity(errors.New("invalid argument"))
+	defer restore()
+
+	vm := newFakeVM(t, types.VMConfig{
+		CPUAmount:  1,
+		CPUPinning: map[int][]int{0: {2}},
+	}, &launchertest.Launcher{})
+
+	assert.NotNil(t, vm.Start())
+
+	// The process is killed
+	assert.NotNil(t, vm.Wait())
+}
+
+func TestPinCPUsUnknownVCPU(t *testing.T) {
+	_, restore := withFakeAffinity(nil)
+	defer restore()
+
+	vm := newFakeVM(t, types.VMConfig{
+		CPUAmount:  1,
+		CPUPinning: map[int][]int{4: {2}},
+	}, &launchertest.Launcher{})
+
+	assert.NotNil(t, vm.Start())
+	assert.NotNil(t, vm.Wait())
+}
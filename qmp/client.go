@@ -0,0 +1,120 @@
+package qmp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+var (
+	ErrNotConnected = errors.New("Not connected to the QMP server")
+)
+
+// QMP error classes, see qapi/error.json in the QEMU sources
+const (
+	ERROR_CLASS_GENERIC           = "GenericError"
+	ERROR_CLASS_COMMAND_NOT_FOUND = "CommandNotFound"
+	ERROR_CLASS_DEVICE_NOT_ACTIVE = "DeviceNotActive"
+	ERROR_CLASS_DEVICE_NOT_FOUND  = "DeviceNotFound"
+	ERROR_CLASS_KVM_MISSING_CAP   = "KVMMissingCap"
+)
+
+// Part of the go-qemu monitor used by the client, any fake implementing it
+// can be used in tests. The error replies are only returned as *Error if Run
+// returns them as is, like SocketMonitor does: go-qemu's qmp.SocketMonitor
+// turns them into plain errors without class.
+type Monitor interface {
+	Run(command []byte) (out []byte, err error)
+}
+
+type Command struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+// Error reply from the QMP server
+type Error struct {
+	Command string `json:"-"`
+	Class   string `json:"class"`
+	Desc    string `json:"desc"`
+}
+
+func (e *Error) Error() string {
+	return "QMP " + e.Command + " failed (" + e.Class + "): " + e.Desc
+}
+
+type reply struct {
+	Return json.RawMessage `json:"return"`
+	Error  *Error          `json:"error"`
+}
+
+type Client struct {
+	monitor Monitor
+}
+
+func NewClient(monitor Monitor) *Client {
+	return &Client{
+		monitor: monitor,
+	}
+}
+
+// Runs the command and decodes its return value into res, unless res is nil.
+// QMP error replies are returned as *Error. A nil client returns
+// ErrNotConnected.
+func (c *Client) Execute(ctx context.Context, cmd Command, res interface{}) error {
+	if c == nil || c.monitor == nil {
+		return ErrNotConnected
+	}
+
+	raw, err := json.Marshal(cmd)
+
+	if err != nil {
+		return err
+	}
+
+	out, err := c.run(ctx, raw)
+
+	if err != nil {
+		return err
+	}
+
+	var r reply
+
+	if err := json.Unmarshal(out, &r); err != nil {
+		return errors.New("Invalid QMP reply to " + cmd.Execute + ": " + err.Error())
+	}
+
+	if r.Error != nil {
+		r.Error.Command = cmd.Execute
+		return r.Error
+	}
+
+	if res == nil || len(r.Return) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(r.Return, res)
+}
+
+// The monitor doesn't support cancellation, the command keeps running in the
+// background when the context is done.
+func (c *Client) run(ctx context.Context, command []byte) ([]byte, error) {
+	type result struct {
+		out []byte
+		err error
+	}
+
+	res := make(chan result, 1)
+
+	go func() {
+		out, err := c.monitor.Run(command)
+		res <- result{out, err}
+	}()
+
+	select {
+	case r := <-res:
+		return r.out, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+package qmp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMonitor struct {
+	commands []string
+	reply    string
+	block    chan bool
+}
+
+func (m *fakeMonitor) Run(command []byte) ([]byte, error) {
+	m.commands = append(m.commands, string(command))
+
+	if m.block != nil {
+		<-m.block
+	}
+
+	return []byte(m.reply), nil
+}
+
+func TestClientExecute(t *testing.T) {
+	monitor := &fakeMonitor{
+		reply: `{"return": {"status": "paused", "running": false, "singlestep": false}}`,
+	}
+	client := NewClient(monitor)
+
+	status, err := client.QueryStatus(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, status, StatusInfo{Status: "paused"})
+	assert.Equal(t, monitor.commands, []string{`{"execute":"query-status"}`})
+}
+
+func TestClientExecuteArguments(t *testing.T) {
+	monitor := &fakeMonitor{reply: `{"return": {}}`}
+	client := NewClient(monitor)
+
+	cmd := Command{
+		Execute:   "device_del",
+		Arguments: map[string]string{"id": "net1"},
+	}
+
+	assert.Nil(t, client.Execute(context.Background(), cmd, nil))
+	assert.Equal(t, monitor.commands, []string{`{"execute":"device_del","arguments":{"id":"net1"}}`})
+}
+
+func TestClientExecuteError(t *testing.T) {
+	monitor := &fakeMonitor{
+		reply: `{"error": {"class": "CommandNotFound", "desc": "The command foo has not been found"}}`,
+	}
+	client := NewClient(monitor)
+
+	err := client.Execute(context.Background(), Command{Execute: "foo"}, nil)
+
+	qmpErr, ok := err.(*Error)
+	require.True(t, ok)
+	assert.Equal(t, qmpErr.Class, ERROR_CLASS_COMMAND_NOT_FOUND)
+	assert.Equal(t, qmpErr.Command, "foo")
+}
+
+func TestClientExecuteContext(t *testing.T) {
+	monitor := &fakeMonitor{block: make(chan bool)}
+	defer close(monitor.block)
+
+	client := NewClient(monitor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, client.Stop(ctx), context.DeadlineExceeded)
+}
+
+func TestClientNotConnected(t *testing.T) {
+	var client *Client
+
+	assert.Equal(t, client.Cont(context.Background()), ErrNotConnected)
+}
@@ -0,0 +1,154 @@
+package qmp
+
+import "context"
+
+// Return value of query-status
+type StatusInfo struct {
+	// See RunState in qapi/run-state.json: running, paused, shutdown,
+	// guest-panicked, …
+	Status     string `json:"status"`
+	Running    bool   `json:"running"`
+	Singlestep bool   `json:"singlestep"`
+}
+
+// Element of the return value of query-commands
+type CommandInfo struct {
+	Name string `json:"name"`
+}
+
+// Return value of query-version
+type VersionInfo struct {
+	QEMU struct {
+		Major int `json:"major"`
+		Minor int `json:"minor"`
+		Micro int `json:"micro"`
+	} `json:"qemu"`
+	Package string `json:"package"`
+}
+
+// Element of the return value of query-cpus-fast (QEMU 2.12+)
+type CPUInfoFast struct {
+	CPUIndex int    `json:"cpu-index"`
+	QOMPath  string `json:"qom-path"`
+	ThreadId int    `json:"thread-id"`
+}
+
+// Element of the return value of query-cpus, replaced by query-cpus-fast
+type CPUInfo struct {
+	CPU      int  `json:"CPU"`
+	Current  bool `json:"current"`
+	Halted   bool `json:"halted"`
+	ThreadId int  `json:"thread_id"`
+}
+
+// Return value of query-balloon
+type BalloonInfo struct {
+	// Memory of the guest, in bytes
+	Actual int64 `json:"actual"`
+}
+
+// Arguments of balloon
+type BalloonArgs struct {
+	// Target memory of the guest, in bytes
+	Value int64 `json:"value"`
+}
+
+// Arguments of change-vnc-password
+type ChangeVNCPasswordArgs struct {
+	Password string `json:"password"`
+}
+
+// Arguments of set_password
+type SetPasswordArgs struct {
+	// vnc or spice
+	Protocol string `json:"protocol"`
+	Password string `json:"password"`
+}
+
+func (c *Client) Stop(ctx context.Context) error {
+	return c.Execute(ctx, Command{Execute: "stop"}, nil)
+}
+
+func (c *Client) Cont(ctx context.Context) error {
+	return c.Execute(ctx, Command{Execute: "cont"}, nil)
+}
+
+func (c *Client) SystemReset(ctx context.Context) error {
+	return c.Execute(ctx, Command{Execute: "system_reset"}, nil)
+}
+
+func (c *Client) SystemPowerdown(ctx context.Context) error {
+	return c.Execute(ctx, Command{Execute: "system_powerdown"}, nil)
+}
+
+func (c *Client) Quit(ctx context.Context) error {
+	return c.Execute(ctx, Command{Execute: "quit"}, nil)
+}
+
+func (c *Client) QueryStatus(ctx context.Context) (StatusInfo, error) {
+	var status StatusInfo
+
+	err := c.Execute(ctx, Command{Execute: "query-status"}, &status)
+
+	return status, err
+}
+
+func (c *Client) QueryCommands(ctx context.Context) ([]CommandInfo, error) {
+	var commands []CommandInfo
+
+	err := c.Execute(ctx, Command{Execute: "query-commands"}, &commands)
+
+	return commands, err
+}
+
+func (c *Client) QueryVersion(ctx context.Context) (VersionInfo, error) {
+	var version VersionInfo
+
+	err := c.Execute(ctx, Command{Execute: "query-version"}, &version)
+
+	return version, err
+}
+
+func (c *Client) QueryCPUsFast(ctx context.Context) ([]CPUInfoFast, error) {
+	var cpus []CPUInfoFast
+
+	err := c.Execute(ctx, Command{Execute: "query-cpus-fast"}, &cpus)
+
+	return cpus, err
+}
+
+// Interrupts the vCPUs, prefer QueryCPUsFast
+func (c *Client) QueryCPUs(ctx context.Context) ([]CPUInfo, error) {
+	var cpus []CPUInfo
+
+	err := c.Execute(ctx, Command{Execute: "query-cpus"}, &cpus)
+
+	return cpus, err
+}
+
+// Asks the balloon driver of the guest to resize its memory to the given
+// amount of bytes
+func (c *Client) Balloon(ctx context.Context, value int64) error {
+	return c.Execute(ctx, Command{Execute: "balloon", Arguments: BalloonArgs{Value: value}}, nil)
+}
+
+func (c *Client) QueryBalloon(ctx context.Context) (BalloonInfo, error) {
+	var balloon BalloonInfo
+
+	err := c.Execute(ctx, Command{Execute: "query-balloon"}, &balloon)
+
+	return balloon, err
+}
+
+// Sets the password of the VNC server, QEMU must be started with
+// password=on
+func (c *Client) ChangeVNCPassword(ctx context.Context, password string) error {
+	return c.Execute(ctx, Command{Execute: "change-vnc-password", Arguments: ChangeVNCPasswordArgs{Password: password}}, nil)
+}
+
+// Sets the password of the display server of the protocol (vnc or spice)
+func (c *Client) SetPassword(ctx context.Context, protocol, password string) error {
+	args := SetPasswordArgs{Protocol: protocol, Password: password}
+
+	return c.Execute(ctx, Command{Execute: "set_password", Arguments: args}, nil)
+}
@@ -0,0 +1,155 @@
+package qmp
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp"
+)
+
+var (
+	ErrMonitorClosed = errors.New("QMP connection closed")
+)
+
+// Connection to a QMP server, implementing the go-qemu qmp.Monitor interface.
+// Unlike qmp.SocketMonitor, which turns the error replies into plain errors,
+// Run returns every reply as is, so that the Client keeps their class.
+type SocketMonitor struct {
+	// Version of QEMU, from the greeting of the server
+	Version *qmp.Version
+
+	conn      net.Conn
+	mutex     sync.Mutex
+	replies   chan json.RawMessage
+	events    chan qmp.Event
+	listeners int32
+}
+
+// Connects to the server, see Connect for the capabilities negotiation.
+func NewSocketMonitor(network, addr string, timeout time.Duration) (*SocketMonitor, error) {
+	conn, err := net.DialTimeout(network, addr, timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SocketMonitor{conn: conn}, nil
+}
+
+// Reads the greeting of the server and negotiates the capabilities, the
+// commands can be run afterwards.
+func (m *SocketMonitor) Connect() error {
+	decoder := json.NewDecoder(m.conn)
+
+	var greeting struct {
+		QMP *struct {
+			Version qmp.Version `json:"version"`
+		} `json:"QMP"`
+	}
+
+	if err := decoder.Decode(&greeting); err != nil {
+		return err
+	}
+
+	if greeting.QMP == nil {
+		return errors.New("Invalid QMP greeting")
+	}
+
+	m.Version = &greeting.QMP.Version
+
+	if _, err := m.conn.Write([]byte(`{"execute":"qmp_capabilities"}`)); err != nil {
+		return err
+	}
+
+	var r reply
+
+	if err := decoder.Decode(&r); err != nil {
+		return err
+	}
+
+	if r.Error != nil {
+		r.Error.Command = "qmp_capabilities"
+		return r.Error
+	}
+
+	m.replies = make(chan json.RawMessage)
+	m.events = make(chan qmp.Event)
+
+	go m.listen(decoder)
+
+	return nil
+}
+
+func (m *SocketMonitor) Disconnect() error {
+	atomic.StoreInt32(&m.listeners, 0)
+
+	return m.conn.Close()
+}
+
+// Returns the raw reply to the command, including error replies. Commands are
+// run one at a time.
+func (m *SocketMonitor) Run(command []byte) ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.replies == nil {
+		return nil, ErrNotConnected
+	}
+
+	if _, err := m.conn.Write(command); err != nil {
+		return nil, err
+	}
+
+	out, ok := <-m.replies
+
+	if !ok {
+		return nil, ErrMonitorClosed
+	}
+
+	return out, nil
+}
+
+// Receives the events until the connection is closed. The events are
+// dropped until Events is called, the channel must be drained afterwards.
+func (m *SocketMonitor) Events() (<-chan qmp.Event, error) {
+	if m.events == nil {
+		return nil, ErrNotConnected
+	}
+
+	atomic.AddInt32(&m.listeners, 1)
+
+	return m.events, nil
+}
+
+func (m *SocketMonitor) listen(decoder *json.Decoder) {
+	defer close(m.replies)
+	defer close(m.events)
+
+	for {
+		var raw json.RawMessage
+
+		if err := decoder.Decode(&raw); err != nil {
+			return
+		}
+
+		var e qmp.Event
+
+		if err := json.Unmarshal(raw, &e); err != nil {
+			continue
+		}
+
+		// Not an event, the reply to the running command
+		if e.Event == "" {
+			m.replies <- raw
+			continue
+		}
+
+		if atomic.LoadInt32(&m.listeners) > 0 {
+			m.events <- e
+		}
+	}
+}
@@ -0,0 +1,400 @@
+// Package qmptest provides an in-memory QMP server to test code driving QEMU
+// without a kvm binary.
+package qmptest
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	schnappsqmp "github.com/bytearena/schnapps/qmp"
+	"github.com/bytearena/schnapps/types"
+)
+
+// Computes the return value of a command, a non-nil *schnappsqmp.Error is
+// sent as an error reply.
+type Handler func(args json.RawMessage) (interface{}, *schnappsqmp.Error)
+
+// Command received by the server
+type Command struct {
+	Execute   string          `json:"execute"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Id        interface{}     `json:"id,omitempty"`
+}
+
+type conn struct {
+	net.Conn
+	writeMutex sync.Mutex
+}
+
+func (c *conn) send(msg interface{}) error {
+	buf, err := json.Marshal(msg)
+
+	if err != nil {
+		return err
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	_, err = c.Write(append(buf, '\n'))
+
+	return err
+}
+
+type Server struct {
+	listener net.Listener
+
+	mutex    sync.Mutex
+	handlers map[string]Handler
+	after    map[string][]func()
+	commands []Command
+	conns    map[*conn]bool
+	running  bool
+	received chan Command
+}
+
+// Starts a QMP server listening on a random local TCP port, see Listen.
+func NewServer() (*Server, error) {
+	return Listen("tcp", "127.0.0.1:0")
+}
+
+// Starts a QMP server listening on the given address. By default it
+// behaves like QEMU for stop, cont, system_reset, system_powerdown, quit,
+// query-status and query-commands, including the events they emit. Other
+// commands reply with a CommandNotFound error until a handler is registered.
+func Listen(protocol, addr string) (*Server, error) {
+	listener, err := net.Listen(protocol, addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: listener,
+		handlers: make(map[string]Handler),
+		after:    make(map[string][]func()),
+		conns:    make(map[*conn]bool),
+		running:  true,
+		received: make(chan Command, 64),
+	}
+
+	s.registerDefaultHandlers()
+
+	go s.accept()
+
+	return s, nil
+}
+
+// Configuration to pass to the VM (or the QMP monitor)
+func (s *Server) Config() *types.QMPServer {
+	return &types.QMPServer{
+		Protocol: s.listener.Addr().Network(),
+		Addr:     s.listener.Addr().String(),
+	}
+}
+
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Registers the handler of a command, replacing the existing one.
+func (s *Server) Handle(command string, handler Handler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.handlers[command] = handler
+}
+
+// Replies res to every call of the command.
+func (s *Server) SetResponse(command string, res interface{}) {
+	s.Handle(command, func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+		return res, nil
+	})
+}
+
+// Replies an error to every call of the command.
+func (s *Server) SetError(command, class, desc string) {
+	s.Handle(command, func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+		return nil, &schnappsqmp.Error{Class: class, Desc: desc}
+	})
+}
+
+// Calls fn after each successful reply to the command.
+func (s *Server) After(command string, fn func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.after[command] = append(s.after[command], fn)
+}
+
+// Emits an event after each successful reply to the command, the way QEMU
+// emits STOP after replying to stop.
+func (s *Server) EmitAfter(command, name string, data map[string]interface{}) {
+	s.After(command, func() {
+		s.Emit(name, data)
+	})
+}
+
+// Commands received so far, in order, excluding the capabilities negotiation.
+func (s *Server) Commands() []Command {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Command{}, s.commands...)
+}
+
+// Receives the commands as they are received, commands are dropped if nobody
+// reads them.
+func (s *Server) Received() <-chan Command {
+	return s.received
+}
+
+// Sends an event to every connected client.
+func (s *Server) Emit(event string, data map[string]interface{}) error {
+	now := time.Now()
+
+	msg := map[string]interface{}{
+		"event": event,
+		"timestamp": map[string]int64{
+			"seconds":      now.Unix(),
+			"microseconds": int64(now.Nanosecond() / 1000),
+		},
+	}
+
+	if data != nil {
+		msg["data"] = data
+	}
+
+	s.mutex.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mutex.Unlock()
+
+	for _, c := range conns {
+		if err := c.send(msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Closes the listener and every connection.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for c := range s.conns {
+		c.Close()
+		delete(s.conns, c)
+	}
+
+	return err
+}
+
+func (s *Server) accept() {
+	for {
+		netConn, err := s.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		c := &conn{Conn: netConn}
+
+		s.mutex.Lock()
+		s.conns[c] = true
+		s.mutex.Unlock()
+
+		go s.serve(c)
+	}
+}
+
+func (s *Server) serve(c *conn) {
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, c)
+		s.mutex.Unlock()
+
+		c.Close()
+	}()
+
+	greeting := map[string]interface{}{
+		"QMP": map[string]interface{}{
+			"version": map[string]interface{}{
+				"qemu":    map[string]int{"major": 2, "minor": 8, "micro": 1},
+				"package": "qmptest",
+			},
+			"capabilities": []string{},
+		},
+	}
+
+	if err := c.send(greeting); err != nil {
+		return
+	}
+
+	decoder := json.NewDecoder(c)
+	negotiated := false
+
+	for {
+		var cmd Command
+
+		if err := decoder.Decode(&cmd); err != nil {
+			return
+		}
+
+		if cmd.Execute == "qmp_capabilities" {
+			negotiated = true
+			c.send(returnReply(cmd, struct{}{}))
+			continue
+		}
+
+		if !negotiated {
+			c.send(errorReply(cmd, &schnappsqmp.Error{
+				Class: schnappsqmp.ERROR_CLASS_COMMAND_NOT_FOUND,
+				Desc:  "Expecting capabilities negotiation with 'qmp_capabilities'",
+			}))
+			continue
+		}
+
+		reply, ok := s.dispatch(cmd)
+
+		if err := c.send(reply); err != nil {
+			return
+		}
+
+		if !ok {
+			continue
+		}
+
+		s.mutex.Lock()
+		after := s.after[cmd.Execute]
+		s.mutex.Unlock()
+
+		for _, fn := range after {
+			fn()
+		}
+	}
+}
+
+func (s *Server) dispatch(cmd Command) (interface{}, bool) {
+	s.mutex.Lock()
+	s.commands = append(s.commands, cmd)
+	handler, hasHandler := s.handlers[cmd.Execute]
+	s.mutex.Unlock()
+
+	select {
+	case s.received <- cmd:
+	default:
+	}
+
+	if !hasHandler {
+		return errorReply(cmd, &schnappsqmp.Error{
+			Class: schnappsqmp.ERROR_CLASS_COMMAND_NOT_FOUND,
+			Desc:  "The command " + cmd.Execute + " has not been found",
+		}), false
+	}
+
+	res, qmpErr := handler(cmd.Arguments)
+
+	if qmpErr != nil {
+		return errorReply(cmd, qmpErr), false
+	}
+
+	if res == nil {
+		res = struct{}{}
+	}
+
+	return returnReply(cmd, res), true
+}
+
+func returnReply(cmd Command, res interface{}) interface{} {
+	reply := map[string]interface{}{"return": res}
+
+	if cmd.Id != nil {
+		reply["id"] = cmd.Id
+	}
+
+	return reply
+}
+
+func errorReply(cmd Command, err *schnappsqmp.Error) interface{} {
+	reply := map[string]interface{}{"error": err}
+
+	if cmd.Id != nil {
+		reply["id"] = cmd.Id
+	}
+
+	return reply
+}
+
+func (s *Server) setRunning(running bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.running = running
+}
+
+// Mimics QEMU
+func (s *Server) registerDefaultHandlers() {
+	s.handlers["stop"] = func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+		s.setRunning(false)
+		return nil, nil
+	}
+	s.EmitAfter("stop", "STOP", nil)
+
+	s.handlers["cont"] = func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+		s.setRunning(true)
+		return nil, nil
+	}
+	s.EmitAfter("cont", "RESUME", nil)
+
+	s.handlers["system_reset"] = func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+		return nil, nil
+	}
+	s.EmitAfter("system_reset", "RESET", map[string]interface{}{
+		"guest":  false,
+		"reason": "host-qmp-system-reset",
+	})
+
+	s.handlers["system_powerdown"] = func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+		return nil, nil
+	}
+	s.EmitAfter("system_powerdown", "POWERDOWN", nil)
+
+	s.handlers["quit"] = func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+		return nil, nil
+	}
+
+	s.handlers["query-status"] = func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		status := "paused"
+
+		if s.running {
+			status = "running"
+		}
+
+		return schnappsqmp.StatusInfo{Status: status, Running: s.running}, nil
+	}
+
+	s.handlers["query-commands"] = func(args json.RawMessage) (interface{}, *schnappsqmp.Error) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		commands := []schnappsqmp.CommandInfo{{Name: "qmp_capabilities"}}
+
+		for name := range s.handlers {
+			commands = append(commands, schnappsqmp.CommandInfo{Name: name})
+		}
+
+		return commands, nil
+	}
+}
@@ -0,0 +1,127 @@
+package qmptest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	schnappsqmp "github.com/bytearena/schnapps/qmp"
+	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func connect(t *testing.T, server *Server) (*schnappsqmp.SocketMonitor, *schnappsqmp.Client) {
+	monitor, err := schnappsqmp.NewSocketMonitor("tcp", server.Addr(), time.Second)
+	require.Nil(t, err)
+	require.Nil(t, monitor.Connect())
+
+	return monitor, schnappsqmp.NewClient(monitor)
+}
+
+func TestServerCommands(t *testing.T) {
+	server, err := NewServer()
+	require.Nil(t, err)
+	defer server.Close()
+
+	monitor, client := connect(t, server)
+	defer monitor.Disconnect()
+
+	ctx := context.Background()
+
+	assert.Nil(t, client.Stop(ctx))
+
+	status, err := client.QueryStatus(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, status.Status, "paused")
+
+	commands := server.Commands()
+	assert.Len(t, commands, 2)
+	assert.Equal(t, commands[0].Execute, "stop")
+	assert.Equal(t, commands[1].Execute, "query-status")
+}
+
+func TestServerCannedResponses(t *testing.T) {
+	server, err := NewServer()
+	require.Nil(t, err)
+	defer server.Close()
+
+	monitor, client := connect(t, server)
+	defer monitor.Disconnect()
+
+	ctx := context.Background()
+
+	server.SetResponse("query-commands", []schnappsqmp.CommandInfo{{Name: "quit"}})
+
+	commands, err := client.QueryCommands(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, commands, []schnappsqmp.CommandInfo{{Name: "quit"}})
+
+	server.SetError("cont", schnappsqmp.ERROR_CLASS_GENERIC, "Resetting the Virtual Machine is required")
+
+	err = client.Cont(ctx)
+	qmpErr, ok := err.(*schnappsqmp.Error)
+	require.True(t, ok)
+	assert.Equal(t, qmpErr.Class, schnappsqmp.ERROR_CLASS_GENERIC)
+
+	_, err = client.QueryVersion(ctx)
+	qmpErr, ok = err.(*schnappsqmp.Error)
+	require.True(t, ok)
+	assert.Equal(t, qmpErr.Class, schnappsqmp.ERROR_CLASS_COMMAND_NOT_FOUND)
+}
+
+func TestServerEvents(t *testing.T) {
+	server, err := NewServer()
+	require.Nil(t, err)
+	defer server.Close()
+
+	monitor, client := connect(t, server)
+	defer monitor.Disconnect()
+
+	events, err := monitor.Events()
+	require.Nil(t, err)
+
+	assert.Nil(t, client.Stop(context.Background()))
+	assert.Equal(t, (<-events).Event, "STOP")
+
+	assert.Nil(t, server.Emit("GUEST_PANICKED", map[string]interface{}{"action": "pause"}))
+
+	e := <-events
+	assert.Equal(t, e.Event, "GUEST_PANICKED")
+	assert.Equal(t, e.Data["action"], "pause")
+}
+
+func TestSocketMonitorErrors(t *testing.T) {
+	server, err := NewServer()
+	require.Nil(t, err)
+
+	monitor, client := connect(t, server)
+	defer monitor.Disconnect()
+
+	assert.Equal(t, monitor.Version.QEMU.Major, 2)
+
+	server.SetError("system_powerdown", schnappsqmp.ERROR_CLASS_GENERIC, "ACPI is disabled")
+
+	var qmpErr *schnappsqmp.Error
+
+	err = client.SystemPowerdown(context.Background())
+	require.True(t, errors.As(err, &qmpErr))
+	assert.Equal(t, qmpErr.Command, "system_powerdown")
+	assert.Equal(t, qmpErr.Class, schnappsqmp.ERROR_CLASS_GENERIC)
+	assert.Equal(t, qmpErr.Desc, "ACPI is disabled")
+
+	// go-qemu's monitor only keeps the description
+	goqemuMonitor, err := qmp.NewSocketMonitor("tcp", server.Addr(), time.Second)
+	require.Nil(t, err)
+	require.Nil(t, goqemuMonitor.Connect())
+	defer goqemuMonitor.Disconnect()
+
+	err = schnappsqmp.NewClient(goqemuMonitor).SystemPowerdown(context.Background())
+	assert.NotNil(t, err)
+	assert.False(t, errors.As(err, &qmpErr))
+
+	server.Close()
+
+	assert.NotNil(t, client.Stop(context.Background()))
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/bytearena/schnapps"
+	"github.com/bytearena/schnapps/logger"
 )
 
 var (
@@ -38,6 +39,9 @@ type Pool struct {
 
 	stopTheWorldMutex sync.Mutex
 	tickGC            *time.Ticker
+
+	log      logger.Logger
+	logMutex sync.Mutex
 }
 
 func NewFixedVMPool(size int) (*Pool, error) {
@@ -64,6 +68,21 @@ func NewFixedVMPool(size int) (*Pool, error) {
 	return pool, nil
 }
 
+// logger.Default() is used until a logger is set
+func (p *Pool) SetLogger(l logger.Logger) {
+	p.logMutex.Lock()
+	defer p.logMutex.Unlock()
+
+	p.log = l
+}
+
+func (p *Pool) logger() logger.Logger {
+	p.logMutex.Lock()
+	defer p.logMutex.Unlock()
+
+	return logger.OrDefault(p.log)
+}
+
 /*
 	The garbage collection is reponsible for maintaining a healthy set of VM.
 */
@@ -92,6 +111,7 @@ func (p *Pool) gc() {
 
 	select {
 	case <-timeoutChan:
+		p.logger().Warn("Healthchecks timed out")
 	case <-waitChan:
 		queue := make(map[*vm.VM]bool)
 
@@ -143,7 +163,11 @@ func (p *Pool) processHealtcheckConsumerQueue(queue map[*vm.VM]bool) {
 
 			p.nokHealthChecksByVm[vm]++
 
+			p.logger().Debug("Healthcheck failed", logger.KEY_VM_ID, vm.Config.Id, "failures", p.nokHealthChecksByVm[vm])
+
 			if p.nokHealthChecksByVm[vm] >= NOK_HEALTCH_BEFORE_REMOVAL {
+				p.logger().Warn("Removing unhealthy VM", logger.KEY_VM_ID, vm.Config.Id)
+
 				delete(p.nokHealthChecksByVm, vm)
 				p.Delete(vm)
 			}
@@ -175,6 +199,8 @@ func (p *Pool) init() error {
 		}
 	})
 
+	p.logger().Info("Pool ready", "size", p.size)
+
 	p.produceEvent(READY{})
 
 	return nil
@@ -263,6 +289,7 @@ func (p *Pool) consumeEvents() {
 					p.healthcheckConsumerQueue[msg.VM] = msg.Res
 				} else {
 					err := errors.New("Unexpected healtchcheck")
+					p.logger().Error("Scheduler error", append(vmLogArgs(msg.VM), logger.KEY_ERROR, err)...)
 					p.produceEvent(ERROR{err})
 				}
 
@@ -276,6 +303,7 @@ func (p *Pool) consumeEvents() {
 				if err == nil {
 					atomic.AddInt32(&p.initCount, -1)
 				} else {
+					p.logger().Error("Scheduler error", append(vmLogArgs(msg.VM), logger.KEY_ERROR, err)...)
 					p.produceEvent(ERROR{err})
 				}
 
@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"github.com/bytearena/schnapps"
+	"github.com/bytearena/schnapps/logger"
 )
 
 func isVmInQueue(queue Queue, vm *vm.VM) bool {
@@ -13,3 +14,11 @@ func isVmInQueue(queue Queue, vm *vm.VM) bool {
 
 	return false
 }
+
+func vmLogArgs(vm *vm.VM) []interface{} {
+	if vm == nil {
+		return []interface{}{}
+	}
+
+	return []interface{}{logger.KEY_VM_ID, vm.Config.Id}
+}
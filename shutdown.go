@@ -0,0 +1,209 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/bytearena/schnapps/libvirt"
+	"github.com/bytearena/schnapps/logger"
+	schnappsqmp "github.com/bytearena/schnapps/qmp"
+)
+
+var (
+	DefaultShutdownPolicy = ShutdownPolicy{
+		PowerdownTimeout: time.Duration(30 * time.Second),
+		QuitTimeout:      time.Duration(3 * time.Second),
+		TermTimeout:      time.Duration(5 * time.Second),
+		KillTimeout:      time.Duration(5 * time.Second),
+	}
+
+	// Time given to QEMU to exit once the QMP socket is closed
+	QMP_EXIT_GRACE_PERIOD = time.Duration(time.Second)
+
+	ErrShutdownFailed = errors.New("KVM process did not exit after SIGKILL")
+)
+
+type ShutdownStep int
+
+const (
+	// ACPI powerdown request, the guest shuts itself down
+	ShutdownStepPowerdown ShutdownStep = iota
+	// QMP quit command
+	ShutdownStepQuit
+	// SIGTERM sent to the KVM process
+	ShutdownStepTerm
+	// SIGKILL sent to the KVM process
+	ShutdownStepKill
+)
+
+func (s ShutdownStep) String() string {
+	switch s {
+	case ShutdownStepPowerdown:
+		return "powerdown"
+	case ShutdownStepQuit:
+		return "quit"
+	case ShutdownStepTerm:
+		return "SIGTERM"
+	case ShutdownStepKill:
+		return "SIGKILL"
+	}
+
+	return fmt.Sprintf("unknown (%d)", int(s))
+}
+
+// Time given to each step for the process to exit before escalating to the
+// next one. A zero timeout skips the step, except for SIGKILL which is always
+// the last resort.
+type ShutdownPolicy struct {
+	PowerdownTimeout time.Duration
+	QuitTimeout      time.Duration
+	TermTimeout      time.Duration
+	KillTimeout      time.Duration
+}
+
+type ShutdownResult struct {
+	// Step after which the process exited
+	Step     ShutdownStep
+	Duration time.Duration
+}
+
+// Shuts the VM down, escalating from an ACPI powerdown to a QMP quit, then
+// SIGTERM and finally SIGKILL. If the context is done, the remaining steps are
+// skipped and the process is killed.
+func (vm *VM) Shutdown(ctx context.Context, policy ShutdownPolicy) (ShutdownResult, error) {
+	start := time.Now()
+
+	// The vCPUs of a paused or crashed guest can't handle the ACPI powerdown
+	from := vm.State()
+	stopped := from == StatePaused || from == StateCrashed
+
+	if err := vm.setState(StateShuttingDown); err != nil {
+		return ShutdownResult{}, err
+	}
+
+	steps := []struct {
+		step    ShutdownStep
+		timeout time.Duration
+		run     func(ctx context.Context) error
+	}{
+		{ShutdownStepPowerdown, policy.PowerdownTimeout, vm.powerdown},
+		{ShutdownStepQuit, policy.QuitTimeout, vm.quit},
+		{ShutdownStepTerm, policy.TermTimeout, vm.terminate},
+	}
+
+	for _, s := range steps {
+		if s.timeout == 0 || ctx.Err() != nil {
+			continue
+		}
+
+		if s.step == ShutdownStepPowerdown && stopped {
+			continue
+		}
+
+		vm.log().Info("Shutting down...", "step", s.step.String())
+
+		stepCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		err := s.run(stepCtx)
+		cancel()
+
+		if err == nil {
+			return ShutdownResult{Step: s.step, Duration: time.Since(start)}, nil
+		}
+
+		vm.log().Warn("Shutdown step failed", "step", s.step.String(), logger.KEY_ERROR, err)
+	}
+
+	killTimeout := policy.KillTimeout
+
+	if killTimeout == 0 {
+		killTimeout = DefaultShutdownPolicy.KillTimeout
+	}
+
+	killCtx, cancel := context.WithTimeout(context.Background(), killTimeout)
+	defer cancel()
+
+	if err := vm.kill(killCtx); err != nil {
+		return ShutdownResult{}, wrapError(ErrShutdownFailed, err)
+	}
+
+	return ShutdownResult{Step: ShutdownStepKill, Duration: time.Since(start)}, nil
+}
+
+func (vm *VM) powerdown(ctx context.Context) error {
+	events, cancel := vm.Subscribe(libvirt.EVENT_SHUTDOWN)
+	defer cancel()
+
+	if err := vm.qmp.SystemPowerdown(ctx); err != nil {
+		return vm.unlessExited(ctx, err)
+	}
+
+	// Wait for the guest to acknowledge the request
+	select {
+	case <-events:
+	case <-vm.exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return vm.waitExited(ctx)
+}
+
+func (vm *VM) quit(ctx context.Context) error {
+	if err := vm.qmp.Quit(ctx); err != nil {
+		return vm.unlessExited(ctx, err)
+	}
+
+	return vm.waitExited(ctx)
+}
+
+func (vm *VM) terminate(ctx context.Context) error {
+	if vm.process == nil {
+		return errors.New("Could not terminate process: process not available")
+	}
+
+	if err := vm.process.Signal(syscall.SIGTERM); err != nil {
+		return err
+	}
+
+	return vm.waitExited(ctx)
+}
+
+func (vm *VM) kill(ctx context.Context) error {
+	if err := vm.killProcess(); err != nil {
+		return err
+	}
+
+	return vm.waitExited(ctx)
+}
+
+// QEMU may exit and close the QMP socket before its reply is read, in which
+// case the command succeeded.
+func (vm *VM) unlessExited(ctx context.Context, err error) error {
+	var qmpErr *schnappsqmp.Error
+
+	if errors.As(err, &qmpErr) {
+		return err
+	}
+
+	select {
+	case <-vm.exited:
+		return nil
+	case <-ctx.Done():
+		return err
+	case <-time.After(QMP_EXIT_GRACE_PERIOD):
+		return err
+	}
+}
+
+func (vm *VM) waitExited(ctx context.Context) error {
+	select {
+	case <-vm.exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,98 @@
+package vm
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bytearena/schnapps/launcher/launchertest"
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startFakeVM(t *testing.T, l *launchertest.Launcher) *VM {
+	vm := newFakeVM(t, types.VMConfig{}, l)
+
+	require.Nil(t, vm.Start())
+
+	return vm
+}
+
+func TestShutdownPowerdown(t *testing.T) {
+	vm := startFakeVM(t, &launchertest.Launcher{})
+
+	res, err := vm.Shutdown(context.Background(), DefaultShutdownPolicy)
+
+	assert.Nil(t, err)
+	assert.Equal(t, res.Step, ShutdownStepPowerdown)
+	assert.Equal(t, vm.State(), StateStopped)
+}
+
+func TestShutdownPaused(t *testing.T) {
+	// The paused guest doesn't handle the powerdown
+	l := &launchertest.Launcher{IgnorePowerdown: true}
+	vm := startFakeVM(t, l)
+
+	require.Nil(t, vm.Pause(context.Background()))
+
+	res, err := vm.Shutdown(context.Background(), ShutdownPolicy{
+		PowerdownTimeout: 10 * time.Second,
+		QuitTimeout:      10 * time.Second,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, res.Step, ShutdownStepQuit)
+	assert.True(t, res.Duration < 5*time.Second)
+	assert.Equal(t, vm.State(), StateStopped)
+}
+
+func TestShutdownEscalatesToTerm(t *testing.T) {
+	l := &launchertest.Launcher{IgnorePowerdown: true}
+	vm := startFakeVM(t, l)
+
+	// The guest ignores the powerdown and QEMU fails to quit
+	l.Processes()[0].QMP().SetError("quit", "GenericError", "fake failure")
+
+	res, err := vm.Shutdown(context.Background(), ShutdownPolicy{
+		PowerdownTimeout: 10 * time.Millisecond,
+		QuitTimeout:      time.Second,
+		TermTimeout:      time.Second,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, res.Step, ShutdownStepTerm)
+	assert.Equal(t, l.Processes()[0].Signals(), []os.Signal{syscall.SIGTERM})
+
+	// The error reply to quit is recognized, without waiting for QEMU to exit
+	assert.True(t, res.Duration < QMP_EXIT_GRACE_PERIOD)
+}
+
+func TestShutdownEscalatesToKill(t *testing.T) {
+	l := &launchertest.Launcher{IgnorePowerdown: true, IgnoreTerm: true}
+	vm := startFakeVM(t, l)
+
+	res, err := vm.Shutdown(context.Background(), ShutdownPolicy{
+		PowerdownTimeout: 10 * time.Millisecond,
+		TermTimeout:      10 * time.Millisecond,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, res.Step, ShutdownStepKill)
+	assert.Equal(t, vm.State(), StateStopped)
+
+	status := <-vm.ExitStatus()
+	assert.Equal(t, status.Code, -1)
+}
+
+func TestShutdownStopped(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+	vm.setState(StateStarting)
+	vm.setState(StateStopped)
+
+	_, err := vm.Shutdown(context.Background(), DefaultShutdownPolicy)
+
+	assert.Equal(t, err, &TransitionError{From: StateStopped, To: StateShuttingDown})
+}
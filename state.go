@@ -0,0 +1,202 @@
+package vm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bytearena/schnapps/libvirt"
+	"github.com/bytearena/schnapps/logger"
+)
+
+var (
+	STATE_SUBSCRIBER_BUFFER_SIZE = 16
+)
+
+type State int
+
+const (
+	StateCreated State = iota
+	StateStarting
+	StateRunning
+	StatePaused
+	StateShuttingDown
+	StateCrashed
+	StateStopped
+)
+
+var stateNames = map[State]string{
+	StateCreated:      "created",
+	StateStarting:     "starting",
+	StateRunning:      "running",
+	StatePaused:       "paused",
+	StateShuttingDown: "shutting down",
+	StateCrashed:      "crashed",
+	StateStopped:      "stopped",
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown (%d)", int(s))
+}
+
+// Legal transitions, a transition to the current state is a no-op.
+var transitions = map[State][]State{
+	StateCreated:      {StateStarting},
+	StateStarting:     {StateRunning, StateCrashed, StateStopped},
+	StateRunning:      {StatePaused, StateShuttingDown, StateCrashed, StateStopped},
+	StatePaused:       {StateRunning, StateShuttingDown, StateCrashed, StateStopped},
+	StateShuttingDown: {StateCrashed, StateStopped},
+	StateCrashed:      {StateRunning, StateShuttingDown, StateStopped},
+	StateStopped:      {},
+}
+
+func canTransition(from, to State) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+type TransitionError struct {
+	From State
+	To   State
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("Illegal state transition from %s to %s", e.From, e.To)
+}
+
+type Transition struct {
+	From State
+	To   State
+	Time time.Time
+}
+
+type stateSubscriber struct {
+	ch chan Transition
+}
+
+func (vm *VM) State() State {
+	vm.stateMutex.Lock()
+	defer vm.stateMutex.Unlock()
+
+	return vm.state
+}
+
+// Returns a channel receiving every state transition of the VM. Slow
+// subscribers miss transitions once their buffer is full. The channel is
+// closed once the KVM process has exited or when the cancel function is
+// called, right away if the process has already exited.
+func (vm *VM) SubscribeState() (<-chan Transition, func()) {
+	sub := &stateSubscriber{
+		ch: make(chan Transition, STATE_SUBSCRIBER_BUFFER_SIZE),
+	}
+
+	vm.stateMutex.Lock()
+	defer vm.stateMutex.Unlock()
+
+	if vm.stateClosed {
+		close(sub.ch)
+
+		return sub.ch, func() {}
+	}
+
+	if vm.stateSubscribers == nil {
+		vm.stateSubscribers = make(map[*stateSubscriber]bool)
+	}
+	vm.stateSubscribers[sub] = true
+
+	cancel := func() {
+		vm.stateMutex.Lock()
+		defer vm.stateMutex.Unlock()
+
+		if vm.stateSubscribers[sub] {
+			delete(vm.stateSubscribers, sub)
+			close(sub.ch)
+		}
+	}
+
+	return sub.ch, cancel
+}
+
+func (vm *VM) setState(to State) error {
+	vm.stateMutex.Lock()
+	defer vm.stateMutex.Unlock()
+
+	from := vm.state
+
+	if from == to {
+		return nil
+	}
+
+	if !canTransition(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+
+	vm.state = to
+
+	transition := Transition{From: from, To: to, Time: time.Now()}
+
+	for sub := range vm.stateSubscribers {
+		select {
+		case sub.ch <- transition:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Drives the state from the QMP events
+func (vm *VM) updateStateFromEvent(e Event) {
+	var err error
+
+	switch e.Name {
+	case libvirt.EVENT_STOP:
+		err = vm.setState(StatePaused)
+	case libvirt.EVENT_RESUME:
+		err = vm.setState(StateRunning)
+	case libvirt.EVENT_SHUTDOWN:
+		err = vm.setState(StateShuttingDown)
+	case libvirt.EVENT_RESET:
+		if vm.State() == StateCrashed {
+			err = vm.setState(StateRunning)
+		}
+	case libvirt.EVENT_GUEST_PANICKED:
+		err = vm.setState(StateCrashed)
+	}
+
+	if err != nil {
+		vm.log().Warn("Ignoring event", logger.KEY_EVENT, e.Name, logger.KEY_ERROR, err)
+	}
+}
+
+// Drives the state from the exit of the KVM process
+func (vm *VM) handleExit(status ExitStatus) {
+	to := StateCrashed
+
+	// The process killed after a failed startup is already stopped
+	if state := vm.State(); status.Err == nil || state == StateShuttingDown || state == StateStopped {
+		to = StateStopped
+	}
+
+	if err := vm.setState(to); err != nil {
+		vm.log().Warn("Could not update the state on exit", logger.KEY_ERROR, err)
+	}
+
+	vm.stateMutex.Lock()
+	defer vm.stateMutex.Unlock()
+
+	vm.stateClosed = true
+
+	for sub := range vm.stateSubscribers {
+		delete(vm.stateSubscribers, sub)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,85 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/bytearena/schnapps/libvirt"
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateTransitions(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+	assert.Equal(t, vm.State(), StateCreated)
+
+	assert.Nil(t, vm.setState(StateStarting))
+	assert.Nil(t, vm.setState(StateRunning))
+	assert.Nil(t, vm.setState(StateRunning))
+
+	err := vm.setState(StateStarting)
+	assert.Equal(t, err, &TransitionError{From: StateRunning, To: StateStarting})
+	assert.Equal(t, vm.State(), StateRunning)
+}
+
+func TestStateFromEvents(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+	vm.setState(StateStarting)
+	vm.setState(StateRunning)
+
+	transitions, cancel := vm.SubscribeState()
+	defer cancel()
+
+	vm.updateStateFromEvent(Event{Name: libvirt.EVENT_STOP})
+	assert.Equal(t, vm.State(), StatePaused)
+
+	vm.updateStateFromEvent(Event{Name: libvirt.EVENT_RESUME})
+	assert.Equal(t, vm.State(), StateRunning)
+
+	vm.updateStateFromEvent(Event{Name: libvirt.EVENT_GUEST_PANICKED})
+	assert.Equal(t, vm.State(), StateCrashed)
+
+	vm.handleExit(ExitStatus{Code: 1, Err: ErrProcessExited})
+	assert.Equal(t, vm.State(), StateCrashed)
+
+	expected := []State{StatePaused, StateRunning, StateCrashed}
+
+	for i, to := range expected {
+		transition := <-transitions
+		assert.Equal(t, transition.To, to)
+
+		if i > 0 {
+			assert.Equal(t, transition.From, expected[i-1])
+		}
+	}
+}
+
+func TestStateShutdownExit(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+	vm.setState(StateStarting)
+	vm.setState(StateRunning)
+
+	vm.updateStateFromEvent(Event{Name: libvirt.EVENT_SHUTDOWN})
+	assert.Equal(t, vm.State(), StateShuttingDown)
+
+	vm.handleExit(ExitStatus{Code: -1, Err: ErrProcessExited})
+	assert.Equal(t, vm.State(), StateStopped)
+}
+
+func TestSubscribeStateAfterExit(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+	vm.setState(StateStarting)
+	vm.handleExit(ExitStatus{})
+
+	transitions, cancel := vm.SubscribeState()
+	defer cancel()
+
+	_, ok := <-transitions
+	assert.False(t, ok)
+}
+
+func TestCloseTwice(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+
+	vm.Close()
+	vm.Close()
+}
@@ -0,0 +1,64 @@
+package types
+
+type DiskFormat string
+
+const (
+	DiskFormatRaw   DiskFormat = "raw"
+	DiskFormatQCOW2 DiskFormat = "qcow2"
+)
+
+// Controller the disk is attached to
+type DiskInterface string
+
+const (
+	DiskInterfaceVirtio DiskInterface = "virtio-blk"
+	DiskInterfaceSCSI   DiskInterface = "virtio-scsi"
+	DiskInterfaceNVMe   DiskInterface = "nvme"
+)
+
+// What happens to the guest writes
+type DiskPersistence string
+
+const (
+	// Writes are discarded when the VM exits. This is the default.
+	DiskEphemeral DiskPersistence = "ephemeral"
+	// Writes go to the image
+	DiskPersistent DiskPersistence = "persistent"
+	// Writes go to a qcow2 overlay of the image, created in the work
+	// directory of the VM
+	DiskOverlay DiskPersistence = "overlay"
+)
+
+type Disk struct {
+	// Path of the image on the host
+	Path string
+
+	// Raw by default
+	Format DiskFormat
+
+	ReadOnly bool
+
+	// Host cache mode: none (the default), writeback, writethrough, directsync
+	// or unsafe
+	Cache string
+
+	// Asynchronous IO: threads, native or io_uring, QEMU's default if empty.
+	// Native requires the none or directsync cache mode.
+	AIO string
+
+	// Pass the guest discard (TRIM) requests to the image
+	Discard bool
+
+	// Serial number seen by the guest, for example to find the disk under
+	// /dev/disk/by-id
+	Serial string
+
+	// Virtio-blk by default
+	Interface DiskInterface
+
+	// Position in the boot order, starting at 1. The disk is not in the boot
+	// order if 0.
+	BootOrder int
+
+	Persistence DiskPersistence
+}
@@ -0,0 +1,107 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Network interface of a VM: a host backend (-netdev) connected to a guest
+// device (-device).
+type NIC interface {
+	// Options of the -netdev backend, without its id. Required, a device
+	// without backend can't carry traffic.
+	Netdev() string
+
+	Device() NICDevice
+}
+
+// Guest side of a NIC
+type NICDevice struct {
+	// QEMU device, virtio-net-pci by default
+	Model string
+
+	// Generated by QEMU if empty
+	MAC string
+
+	// Number of queue pairs, multiqueue is enabled above 1
+	Queues int
+}
+
+// Connects to a socket listening on another host or QEMU instance
+type NICSocket struct {
+	Connect string
+	MAC     string
+	Model   string
+}
+
+func (nic NICSocket) Netdev() string {
+	return fmt.Sprintf("socket,connect=%s", nic.Connect)
+}
+
+func (nic NICSocket) Device() NICDevice {
+	return NICDevice{Model: nic.Model, MAC: nic.MAC}
+}
+
+// Existing tap interface of the host. Tap is the only backend supporting
+// multiqueue.
+type NICTap struct {
+	Ifname string
+	MAC    string
+	Model  string
+	Queues int
+}
+
+func (nic NICTap) Netdev() string {
+	netdev := fmt.Sprintf("tap,ifname=%s,script=no,downscript=no", nic.Ifname)
+
+	if nic.Queues > 1 {
+		netdev += ",queues=" + strconv.Itoa(nic.Queues)
+	}
+
+	return netdev
+}
+
+func (nic NICTap) Device() NICDevice {
+	return NICDevice{Model: nic.Model, MAC: nic.MAC, Queues: nic.Queues}
+}
+
+// User mode network stack (SLIRP), no privileges needed
+type NICUser struct {
+	DHCPStart string
+	Net       string
+	MAC       string
+	Model     string
+}
+
+func (nic NICUser) Netdev() string {
+	netdev := "user"
+
+	if nic.Net != "" {
+		netdev += ",net=" + nic.Net
+	}
+
+	if nic.DHCPStart != "" {
+		netdev += ",dhcpstart=" + nic.DHCPStart
+	}
+
+	return netdev
+}
+
+func (nic NICUser) Device() NICDevice {
+	return NICDevice{Model: nic.Model, MAC: nic.MAC}
+}
+
+// Tap interface attached to a host bridge by the QEMU bridge helper
+type NICBridge struct {
+	Bridge string
+	MAC    string
+	Model  string
+}
+
+func (nic NICBridge) Netdev() string {
+	return fmt.Sprintf("bridge,br=%s", nic.Bridge)
+}
+
+func (nic NICBridge) Device() NICDevice {
+	return NICDevice{Model: nic.Model, MAC: nic.MAC}
+}
@@ -1,34 +1,30 @@
 package types
 
-type NICIface struct {
-	Model string
-}
-
-type NICSocket struct {
-	Connect string
-}
-
-type NICTap struct {
-	Ifname string
-}
+import (
+	"context"
+	"time"
 
-type NICUser struct {
-	DHCPStart string
-	Net       string
-}
+	"github.com/bytearena/schnapps/image"
+)
 
 type QMPServer struct {
 	Protocol string
 	Addr     string
 }
 
-type NICBridge struct {
-	Bridge string
-	MAC    string
-}
+// Hardware acceleration used by QEMU
+type Accelerator string
+
+const (
+	// KVM if /dev/kvm is usable, TCG otherwise. This is the default.
+	AcceleratorAuto Accelerator = "auto"
+	AcceleratorKVM  Accelerator = "kvm"
+	// Software emulation, slow but available everywhere
+	AcceleratorTCG Accelerator = "tcg"
+)
 
 type VMConfig struct {
-	NICs          []interface{}
+	NICs          []NIC
 	Id            int
 	ImageLocation string
 	QMPServer     *QMPServer
@@ -36,6 +32,208 @@ type VMConfig struct {
 	CPUAmount     int
 	CPUCoreAmount int
 	Metadata      VMMetadata
+	Boot          BootCheck
+
+	// CPU model: host (requires KVM), max or a named model (Skylake-Server,
+	// …), QEMU's default if empty
+	CPUModel string
+
+	// Features enabled (+) or disabled (-) on top of the model, for example
+	// +avx2 or -hypervisor. Requires a model.
+	CPUFlags []string
+
+	// CPU topology, QEMU computes the missing values
+	CPUSocketAmount int
+	CPUThreadAmount int
+
+	NUMANodes []NUMANode
+
+	// Host CPUs the thread of each vCPU (by index) is pinned to. The vCPUs
+	// not listed are not pinned.
+	CPUPinning map[int][]int
+
+	// Backing of the guest memory, anonymous memory of the QEMU process if
+	// nil
+	Memory *Memory
+
+	// Adds a virtio-balloon device, to reclaim the memory of the guest at
+	// runtime (see VM.SetBalloon)
+	Balloon bool
+
+	// Capture of the serial console output
+	Console Console
+
+	// Graphical console, served by QEMU. None if nil.
+	Display *Display
+
+	// Channel of the QEMU guest agent (see VM.GuestAgent). NewVM adds one,
+	// set it to nil to remove it.
+	GuestAgent *GuestAgent
+
+	// Attached after the raw image of ImageLocation, if any
+	Disks []Disk
+
+	// Boots the kernel directly instead of the bootloader of the disk, no
+	// disk is needed. Initrd and Cmdline require a kernel.
+	Kernel  string
+	Initrd  string
+	Cmdline string
+
+	// Parent of the work directory of the VM, which holds its disk overlays.
+	// The system temporary directory by default.
+	WorkDir string
+
+	// Stores the disk overlays instead of the work directory, to share an
+	// image manager between VMs
+	Images *image.Manager
+
+	// Keep the work directory of the VM when it's closed, to inspect its
+	// disks
+	RetainWorkDir bool
+
+	// Emulator binary, a name looked up in the $PATH or a path (for example
+	// qemu-system-aarch64). Defaults to kvm, or qemu-system-x86_64 when it's
+	// not available or KVM is not used.
+	Binary string
+
+	Accelerator Accelerator
+
+	// QEMU machine type (for example pc, q35 or microvm), QEMU's default if
+	// empty. microvm has no PCI bus, only virtio devices are available.
+	MachineType string
+
+	// UEFI firmware, the default BIOS if nil
+	Firmware *Firmware
+
+	SMBIOS *SMBIOS
+}
+
+// Describes how to detect that the guest has finished booting. The first
+// check to succeed wins.
+type BootCheck struct {
+	// Regular expression matched against each line of the console output
+	ConsoleMarker string
+
+	// Address (host:port) of the guest polled until it accepts a TCP
+	// connection
+	TCPAddr string
+
+	// Polls the guest agent until it replies to a ping. Requires the guest
+	// to run qemu-ga.
+	GuestAgent bool
+
+	// Custom probe polled until it returns no error
+	Probe func(ctx context.Context) error
+
+	PollInterval time.Duration
+
+	// Used by WaitUntilBooted when the caller doesn't provide a context
+	Timeout time.Duration
+}
+
+// The output of the serial console is kept in memory (see VM.ConsoleTail),
+// and optionally written to a log file
+type Console struct {
+	// Bytes kept in memory, console.DEFAULT_BUFFER_SIZE by default
+	BufferSize int
+
+	// Log file of the console output, rotated once it exceeds LogMaxSize
+	// bytes. LogMaxFiles rotated files are kept (path.1, path.2, …).
+	LogFile     string
+	LogMaxSize  int64
+	LogMaxFiles int
+
+	// Unix socket serving the console (see VM.AttachConsole), none if empty
+	Socket string
+
+	// Origins (scheme://host[:port]) of the pages allowed to open a websocket
+	// session (see VM.ConsoleHandler) besides the origin of the server. "*"
+	// allows any origin.
+	AllowedOrigins []string
+}
+
+type DisplayProtocol string
+
+const (
+	DisplayVNC   DisplayProtocol = "vnc"
+	DisplaySPICE DisplayProtocol = "spice"
+)
+
+// VNC or SPICE server of the VM (see VM.DisplayAddr)
+type Display struct {
+	Protocol DisplayProtocol
+
+	// Unix socket of the server, instead of a TCP port
+	Socket string
+
+	// Listening address, 127.0.0.1 by default
+	Addr string
+
+	// Allocated from display.START if 0. VNC ports start at 5900.
+	Port int
+
+	// Required by the clients, set through QMP once QEMU has started. VNC
+	// only uses the first 8 characters.
+	Password string
+}
+
+// virtio-serial channel of qemu-ga
+type GuestAgent struct {
+	// Unix socket of the channel on the host, in the work directory of the
+	// VM if empty
+	Socket string
+}
+
+// NUMA node of the guest
+type NUMANode struct {
+	// Indexes of the vCPUs of the node
+	CPUs []int
+
+	MegMemory int
+}
+
+// Host memory backing the guest memory, and the memory of each NUMA node
+type Memory struct {
+	// Backs the memory with hugepages, Path is the hugetlbfs mount point
+	// (DEFAULT_HUGEPAGES_PATH by default)
+	HugePages bool
+
+	// Directory or file the memory is mapped from, for example /dev/shm
+	Path string
+
+	// Shares the memory with other processes, required by vhost-user devices
+	// (virtio-fs, …). Uses a memfd without Path nor HugePages.
+	Shared bool
+
+	// Allocates the whole memory when the VM starts, instead of on first
+	// access
+	Prealloc bool
+}
+
+// OVMF firmware, mapped as pflash
+type Firmware struct {
+	// Firmware code, read-only
+	Code string
+
+	// Template of the UEFI variable store, each VM gets its own copy in its
+	// work directory. Optional.
+	Vars string
+}
+
+// System information (SMBIOS type 1) shown to the guest, for example in
+// /sys/class/dmi/id
+type SMBIOS struct {
+	Manufacturer string
+	Product      string
+	Version      string
+	Serial       string
+	UUID         string
+	SKU          string
+	Family       string
+
+	// OEM strings (SMBIOS type 11), for example a cloud-init configuration.
+	// Requires QEMU 2.12.
+	OEMStrings []string
 }
 
 type VMMetadata map[string]string
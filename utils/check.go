@@ -1,8 +1,9 @@
 package utils
 
 import (
-	"fmt"
 	"os"
+
+	"github.com/bytearena/schnapps/logger"
 )
 
 func Check(err error, msg string) {
@@ -14,13 +15,13 @@ func Check(err error, msg string) {
 
 func RecoverableCheck(err error, msg string) {
 	if err != nil {
-		fmt.Println(msg + "; " + err.Error())
+		logger.Default().Error(msg, logger.KEY_ERROR, err)
 	}
 }
 
 func Assert(ok bool, msg string) {
 	if !ok {
-		fmt.Println(msg)
+		logger.Default().Error(msg)
 		os.Exit(1)
 	}
 }
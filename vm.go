@@ -2,29 +2,82 @@ package vm
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"os/exec"
+	"math"
+	"net"
+	"regexp"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/bytearena/schnapps/cli"
-	"github.com/bytearena/schnapps/libvirt"
+	"github.com/bytearena/schnapps/console"
+	"github.com/bytearena/schnapps/guestagent"
+	"github.com/bytearena/schnapps/launcher"
+	"github.com/bytearena/schnapps/logger"
 	schnappsqmp "github.com/bytearena/schnapps/qmp"
 	"github.com/bytearena/schnapps/types"
-	"github.com/bytearena/schnapps/utils"
-	"github.com/digitalocean/go-qemu/qmp"
+)
+
+var (
+	QMP_CONNECT_TIMEOUT        = time.Duration(20 * time.Second)
+	QMP_CONNECT_RETRY_INTERVAL = time.Duration(100 * time.Millisecond)
+	QUIT_TIMEOUT               = time.Duration(3 * time.Second)
 )
 
 type VM struct {
-	Config  types.VMConfig
-	stdout  io.ReadCloser
-	stderr  io.ReadCloser
-	process *os.Process
-	qmp     *qmp.SocketMonitor
-	events  chan qmp.Event
+	Config types.VMConfig
+
+	// Starts the emulator process, launcher.ExecLauncher by default
+	Launcher launcher.Launcher
+
+	// logger.Default() if nil
+	Logger logger.Logger
+
+	stdout       io.ReadCloser
+	stderr       io.ReadCloser
+	process      launcher.Process
+	monitor      *schnappsqmp.SocketMonitor
+	qmp          *schnappsqmp.Client
+	capabilities *cli.Capabilities
+	workDir      string
+
+	console         *console.Console
+	consoleMux      *console.Mux
+	consoleListener net.Listener
+	consoleMutex    sync.Mutex
+
+	displayAddr  net.Addr
+	displayPort  int
+	displayMutex sync.Mutex
+
+	guestAgent       *guestagent.Client
+	guestAgentSocket string
+	guestAgentMutex  sync.Mutex
+
+	state            State
+	stateMutex       sync.Mutex
+	stateSubscribers map[*stateSubscriber]bool
+	// The process has exited, new subscriptions are closed right away
+	stateClosed bool
+
+	eventMutex       sync.Mutex
+	eventSubscribers map[*eventSubscriber]bool
+	eventClosed      bool
+
+	closed     bool
+	closeMutex sync.Mutex
+
+	exited     chan struct{}
+	exitErr    error
+	exitStatus chan ExitStatus
+
+	bootMarker *regexp.Regexp
+	booted     chan struct{}
+	bootedOnce sync.Once
 }
 
 func NewVM(config types.VMConfig) *VM {
@@ -35,18 +88,32 @@ func NewVM(config types.VMConfig) *VM {
 		Addr:     "localhost:" + strconv.Itoa(qmpport),
 	}
 
+	if config.GuestAgent == nil {
+		config.GuestAgent = &types.GuestAgent{}
+	}
+
 	return &VM{
-		Config: config,
+		Config:     config,
+		Launcher:   launcher.ExecLauncher{},
+		exited:     make(chan struct{}),
+		exitStatus: make(chan ExitStatus, 1),
+		booted:     make(chan struct{}),
 	}
 }
 
+// Reads the serial console, see ConsoleTail
 func (vm *VM) readStdout(reader io.Reader) {
+	if console := vm.getConsole(); console != nil {
+		reader = io.TeeReader(reader, console)
+	}
+
 	buffReader := bufio.NewReader(reader)
 
 	for {
 		line, _, readErr := buffReader.ReadLine()
 
-		if readErr == io.EOF {
+		// EOF, or the pipe was closed by Close
+		if readErr != nil {
 			break
 		}
 
@@ -54,47 +121,102 @@ func (vm *VM) readStdout(reader io.Reader) {
 			continue
 		}
 
-		vm.Log(string(line))
+		vm.log().Info("Console", "line", string(line))
+		vm.detectBoot(line)
 	}
 }
 
-func (vm *VM) Log(msg string) {
-	fmt.Printf("[VM %d] %s\n", vm.Config.Id, msg)
-}
+// Errors of QEMU itself, not part of the console
+func (vm *VM) readStderr(reader io.Reader) {
+	buffReader := bufio.NewReader(reader)
 
-func (vm *VM) Quit() error {
-	vm.Log("Halting...")
+	for {
+		line, _, readErr := buffReader.ReadLine()
 
-	command := []byte("{ \"execute\": \"quit\" }")
+		if readErr != nil {
+			break
+		}
 
-	if vm.qmp == nil {
-		return errors.New("Cannot halt VM: not connected to the QMP server")
+		if len(line) > 0 {
+			vm.log().Warn("QEMU", "line", string(line))
+		}
 	}
+}
 
-	_, err := vm.qmp.Run(command)
+// Logs at the info level, with the fields of the VM
+func (vm *VM) Log(msg string, args ...interface{}) {
+	vm.log().Info(msg, args...)
+}
 
+func (vm *VM) logError(err error, msg string) {
 	if err != nil {
-		return err
+		vm.log().Warn(msg, logger.KEY_ERROR, err)
 	}
+}
 
-	timeout := time.After(3 * time.Second)
+// Logger with the fields identifying the VM
+func (vm *VM) log() logger.Logger {
+	args := []interface{}{logger.KEY_VM_ID, vm.Config.Id}
 
-	for {
-		select {
-		case e := <-vm.events:
-			if e.Event == libvirt.EVENT_SHUTDOWN {
-				break
-			}
-		case <-timeout:
-			err := vm.killProcess()
+	if vm.Config.QMPServer != nil {
+		args = append(args, logger.KEY_QMP_ADDR, vm.Config.QMPServer.Addr)
+	}
 
-			if err != nil {
-				return err
-			}
+	for _, nic := range vm.Config.NICs {
+		if mac := nic.Device().MAC; mac != "" {
+			args = append(args, logger.KEY_MAC, mac)
+			break
 		}
 	}
 
-	return nil
+	return logger.With(logger.OrDefault(vm.Logger), args...)
+}
+
+func (vm *VM) Quit() error {
+	ctx, cancel := context.WithTimeout(context.Background(), QUIT_TIMEOUT)
+	defer cancel()
+
+	return vm.QuitContext(ctx)
+}
+
+// Asks QEMU to quit and waits for the process to exit. The process is killed
+// if it's still running when the context is done. See Shutdown for a graceful
+// shutdown.
+func (vm *VM) QuitContext(ctx context.Context) error {
+	vm.Log("Halting...")
+
+	if vm.qmp == nil {
+		return fmt.Errorf("Cannot halt VM: %w", ErrQMPNotConnected)
+	}
+
+	policy := ShutdownPolicy{
+		QuitTimeout: time.Duration(math.MaxInt64),
+	}
+
+	_, err := vm.Shutdown(ctx, policy)
+
+	return err
+}
+
+// Receives the exit status of the KVM process, once.
+func (vm *VM) ExitStatus() <-chan ExitStatus {
+	return vm.exitStatus
+}
+
+func (vm *VM) Wait() error {
+	return vm.WaitContext(context.Background())
+}
+
+// Blocks until the KVM process has exited and its resources have been
+// released, or the context is done. The error wraps ErrProcessExited if the
+// process didn't exit cleanly.
+func (vm *VM) WaitContext(ctx context.Context) error {
+	select {
+	case <-vm.exited:
+		return vm.exitErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (vm *VM) killProcess() error {
@@ -109,106 +231,257 @@ func (vm *VM) killProcess() error {
 	return nil
 }
 
+// Releases the resources held by the VM, subsequent calls are no-ops.
 func (vm *VM) Close() {
+	vm.closeMutex.Lock()
+	defer vm.closeMutex.Unlock()
+
+	if vm.closed {
+		return
+	}
+
+	vm.closed = true
+
 	vm.Log("Releasing resources...")
 
-	var closeErr error
+	if vm.monitor != nil {
+		vm.logError(vm.monitor.Disconnect(), "Could not disconnect from qmp server")
+	}
 
-	if vm.qmp != nil {
-		closeErr = vm.qmp.Disconnect()
-		utils.RecoverableCheck(closeErr, "Could not disconnect from qmp server")
+	if vm.stdout != nil {
+		vm.logError(vm.stdout.Close(), "Could not close stdout")
 	}
 
-	closeErr = vm.stdout.Close()
-	utils.RecoverableCheck(closeErr, "Could not close stdout")
+	if vm.stderr != nil {
+		vm.logError(vm.stderr.Close(), "Could not close stderr")
+	}
+
+	if vm.process != nil {
+		vm.logError(vm.process.Release(), "Could not close process")
+	}
 
-	closeErr = vm.stderr.Close()
-	utils.RecoverableCheck(closeErr, "Could not close stderr")
+	vm.closeGuestAgent()
+	vm.closeConsole()
+	vm.releaseDisplay()
+	vm.removeWorkDir()
+}
 
-	closeErr = vm.process.Release()
-	utils.RecoverableCheck(closeErr, "Could not close process")
+func (vm *VM) Start() error {
+	ctx, cancel := context.WithTimeout(context.Background(), QMP_CONNECT_TIMEOUT)
+	defer cancel()
 
-	vm.process = nil
+	return vm.StartContext(ctx)
 }
 
-// FIXME(sven): determine if KVM has booted the VM
-func (vm *VM) WaitUntilBooted() error {
-	fakeProcess := time.After(10 * time.Second)
+// Launches the KVM process and connects to its QMP server. The context only
+// bounds the startup, it doesn't affect the lifetime of the VM. If the QMP
+// server isn't reachable before the context is done, the process is killed.
+// When the startup fails, the VM ends up in StateStopped, not StateCrashed.
+func (vm *VM) StartContext(ctx context.Context) error {
+	if err := vm.setState(StateStarting); err != nil {
+		return err
+	}
 
-	<-fakeProcess
-	return nil
+	if err := vm.launch(); err != nil {
+		vm.setState(StateStopped)
+
+		return err
+	}
+
+	if err := vm.connect(ctx); err != nil {
+		vm.abortStart()
+
+		return err
+	}
+
+	vm.probeCommands(ctx)
+
+	if err := vm.pinCPUs(ctx); err != nil {
+		vm.abortStart()
+
+		return err
+	}
+
+	if err := vm.setDisplayPassword(ctx); err != nil {
+		vm.abortStart()
+
+		return err
+	}
+
+	return vm.setState(StateRunning)
 }
 
-func (vm *VM) Start() error {
-	kvmbin, err := exec.LookPath("kvm")
+// The process was launched but the startup failed, its exit is not a crash
+func (vm *VM) abortStart() {
+	vm.setState(StateStopped)
+	vm.killProcess()
+}
 
-	if err != nil {
-		return errors.New("Error: kvm not found in $PATH")
+func (vm *VM) launch() error {
+	if err := vm.compileBootMarker(); err != nil {
+		return err
 	}
 
-	cmd := cli.CreateKVMCommand(kvmbin, vm.Config)
+	accel, err := launcher.ResolveAccelerator(vm.Config.Accelerator, vm.Config.Binary)
 
-	stdout, stdoutErr := cmd.StdoutPipe()
-	utils.Check(stdoutErr, "Could not get stdout")
+	if err != nil {
+		return err
+	}
 
-	stderr, stderrErr := cmd.StderrPipe()
-	utils.Check(stderrErr, "Could not get stderr")
+	if accel == types.AcceleratorTCG && vm.Config.Accelerator != types.AcceleratorTCG {
+		vm.log().Warn("KVM is not available for the emulator, falling back to TCG (slow)")
+	}
 
-	vm.stdout = stdout
-	vm.stderr = stderr
+	vm.Config.Accelerator = accel
 
 	vm.Log("Starting...")
 
-	err = cmd.Start()
+	l := vm.Launcher
 
-	if err != nil {
-		return errors.New("Error: VM could not be Started: " + err.Error())
+	if l == nil {
+		l = launcher.ExecLauncher{}
 	}
 
-	vm.process = cmd.Process
+	if err := vm.probeCapabilities(l); err != nil {
+		return err
+	}
 
-	go vm.readStdout(stdout)
-	go vm.readStdout(stderr)
+	if err := vm.openConsole(); err != nil {
+		return err
+	}
 
-	// Connect QMP
-	<-time.After(1 * time.Second)
+	config, err := vm.prepareDisks(vm.Config)
 
-	qmp, socketMonitorErr := qmp.NewSocketMonitor(vm.Config.QMPServer.Protocol, vm.Config.QMPServer.Addr, 20*time.Second)
-	utils.Check(socketMonitorErr, "Could not connect to QMP socket")
+	if err == nil {
+		config, err = vm.prepareFirmware(config)
+	}
 
-	monitorErr := qmp.Connect()
+	if err == nil {
+		config, err = vm.prepareDisplay(config)
+	}
 
-	if monitorErr != nil {
-		vm.Close()
+	if err == nil {
+		config, err = vm.prepareGuestAgent(config)
+	}
 
-		return errors.New("Could not connect monitoring to QMP server")
+	if err != nil {
+		vm.removeWorkDir()
+		vm.releaseDisplay()
+		vm.closeGuestAgent()
+		vm.closeConsole()
+
+		return err
 	}
 
-	vm.qmp = qmp
+	process, err := l.Launch(config)
 
-	// Register event consumer
-	events, eventsErr := vm.qmp.Events()
-	utils.Check(eventsErr, "could not consume events")
+	if err != nil {
+		vm.removeWorkDir()
+		vm.releaseDisplay()
+		vm.closeGuestAgent()
+		vm.closeConsole()
 
-	go func() {
-		for {
-			select {
-			case e := <-events:
-				if e.Event != "" {
-					vm.events <- e
-				}
-			}
+		return err
+	}
 
-		}
-	}()
+	vm.process = process
+	vm.serveConsole(process.Stdin())
+	vm.stdout = process.Stdout()
+	vm.stderr = process.Stderr()
+
+	go vm.readStdout(vm.stdout)
+	go vm.readStderr(vm.stderr)
 
 	go func() {
-		waitErr := cmd.Wait()
-		utils.Check(waitErr, "Could not wait VM process")
+		code, waitErr := process.Wait()
+		status := ExitStatus{Code: code}
+
+		if waitErr != nil {
+			status.Err = wrapError(ErrProcessExited, waitErr)
+		}
 
 		vm.Log("Stopped")
 		vm.Close()
+		vm.handleExit(status)
+		vm.closeEventSubscribers()
+
+		vm.exitErr = status.Err
+		vm.exitStatus <- status
+		close(vm.exited)
 	}()
 
 	return nil
 }
+
+func (vm *VM) connect(ctx context.Context) error {
+	monitor, err := vm.connectQMP(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	vm.monitor = monitor
+	vm.qmp = schnappsqmp.NewClient(monitor)
+
+	// Register event consumer
+	events, err := vm.monitor.Events()
+
+	if err != nil {
+		return wrapError(ErrQMPConnect, err)
+	}
+
+	go func() {
+		for e := range events {
+			vm.handleEvent(e)
+		}
+	}()
+
+	return nil
+}
+
+// QEMU opens the QMP socket shortly after the process started, retry until
+// it accepts the connection.
+func (vm *VM) connectQMP(ctx context.Context) (*schnappsqmp.SocketMonitor, error) {
+	server := vm.Config.QMPServer
+
+	for {
+		timeout := QMP_CONNECT_TIMEOUT
+
+		if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+			timeout = time.Until(deadline)
+		}
+
+		monitor, err := schnappsqmp.NewSocketMonitor(server.Protocol, server.Addr, timeout)
+
+		if err == nil {
+			connected := make(chan error, 1)
+
+			go func() {
+				connected <- monitor.Connect()
+			}()
+
+			select {
+			case err := <-connected:
+				if err != nil {
+					monitor.Disconnect()
+
+					return nil, wrapError(ErrQMPConnect, err)
+				}
+
+				return monitor, nil
+			case <-ctx.Done():
+				monitor.Disconnect()
+
+				return nil, wrapError(ErrQMPConnect, ctx.Err())
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, wrapError(ErrQMPConnect, err)
+		case <-vm.exited:
+			return nil, wrapError(ErrQMPConnect, ErrProcessExited)
+		case <-time.After(QMP_CONNECT_RETRY_INTERVAL):
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bytearena/schnapps/launcher"
+	"github.com/bytearena/schnapps/launcher/launchertest"
+	"github.com/bytearena/schnapps/libvirt"
+	"github.com/bytearena/schnapps/logger"
+	"github.com/bytearena/schnapps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartKVMNotFound(t *testing.T) {
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", "")
+	defer os.Setenv("PATH", path)
+
+	vm := NewVM(types.VMConfig{})
+
+	assert.True(t, errors.Is(vm.Start(), ErrKVMNotFound))
+	assert.Equal(t, vm.State(), StateStopped)
+}
+
+func TestStartLaunchError(t *testing.T) {
+	vm := NewVM(types.VMConfig{})
+	vm.Launcher = &launchertest.Launcher{Err: launcher.ErrProcessStart}
+
+	assert.True(t, errors.Is(vm.Start(), ErrProcessStart))
+	assert.Equal(t, vm.State(), StateStopped)
+
+	err := vm.Start()
+	assert.Equal(t, err, &TransitionError{From: StateStopped, To: StateStarting})
+}
+
+func TestStartAndQuit(t *testing.T) {
+	l := &launchertest.Launcher{
+		Console: []string{"Booting kernel...", "Welcome to LinuxKit"},
+	}
+
+	vm := newFakeVM(t, types.VMConfig{
+		Boot: types.BootCheck{ConsoleMarker: "Welcome"},
+	}, l)
+
+	require.Nil(t, vm.Start())
+	assert.Equal(t, vm.State(), StateRunning)
+
+	assert.Nil(t, vm.WaitUntilBooted())
+
+	assert.Nil(t, vm.Quit())
+	assert.Nil(t, vm.Wait())
+	assert.Equal(t, vm.State(), StateStopped)
+
+	status := <-vm.ExitStatus()
+	assert.Equal(t, status, ExitStatus{Code: 0})
+
+	commands := l.Processes()[0].QMP().Commands()
+	assert.Equal(t, commands[len(commands)-1].Execute, "quit")
+}
+
+func TestStartCapabilities(t *testing.T) {
+	l := &launchertest.Launcher{}
+	vm := newFakeVM(t, types.VMConfig{}, l)
+
+	require.Nil(t, vm.Start())
+	defer vm.Quit()
+
+	// The fake launcher can't probe its binary
+	assert.False(t, vm.Capabilities().Known())
+
+	assert.True(t, vm.Capabilities().HasCommand("system_powerdown"))
+	assert.False(t, vm.Capabilities().HasCommand("change-vnc-password"))
+}
+
+func TestCrash(t *testing.T) {
+	l := &launchertest.Launcher{}
+
+	vm := newFakeVM(t, types.VMConfig{
+		Boot: types.BootCheck{ConsoleMarker: "Welcome"},
+	}, l)
+
+	require.Nil(t, vm.Start())
+
+	events, cancel := vm.Subscribe(libvirt.EVENT_GUEST_PANICKED)
+	defer cancel()
+
+	process := l.Processes()[0]
+	process.QMP().Emit(libvirt.EVENT_GUEST_PANICKED, map[string]interface{}{"action": "pause"})
+
+	var data GuestPanickedEventData
+	assert.Nil(t, (<-events).Decode(&data))
+	assert.Equal(t, data.Action, "pause")
+	assert.Equal(t, vm.State(), StateCrashed)
+
+	process.Exit(1)
+
+	err := vm.WaitUntilBooted()
+	assert.True(t, errors.Is(err, ErrProcessExited))
+
+	err = vm.Wait()
+	assert.True(t, errors.Is(err, ErrProcessExited))
+	assert.Equal(t, vm.State(), StateCrashed)
+
+	status := <-vm.ExitStatus()
+	assert.Equal(t, status.Code, 1)
+}
+
+func TestQuitCrashed(t *testing.T) {
+	l := &launchertest.Launcher{}
+	vm := newFakeVM(t, types.VMConfig{}, l)
+
+	require.Nil(t, vm.Start())
+
+	states, cancel := vm.SubscribeState()
+	defer cancel()
+
+	process := l.Processes()[0]
+	process.QMP().Emit(libvirt.EVENT_GUEST_PANICKED, map[string]interface{}{"action": "pause"})
+
+	assert.Equal(t, (<-states).To, StateCrashed)
+
+	// A crashed VM can still be torn down
+	assert.Nil(t, vm.Quit())
+
+	select {
+	case <-process.Exited():
+	case <-time.After(time.Second):
+		assert.Fail(t, "The process is still running")
+	}
+
+	assert.Equal(t, vm.State(), StateStopped)
+}
+
+func TestStartQMPTimeout(t *testing.T) {
+	l := &launchertest.Launcher{}
+
+	vm := NewVM(types.VMConfig{})
+
+	// The fake process doesn't listen on the address of the VM config
+	vm.Launcher = launcherFunc(func(config types.VMConfig) (launcher.Process, error) {
+		config.QMPServer = &types.QMPServer{Protocol: "tcp", Addr: "127.0.0.1:0"}
+		return l.Launch(config)
+	})
+	vm.Config.QMPServer.Addr = "127.0.0.1:1"
+
+	transitions, cancelTransitions := vm.SubscribeState()
+	defer cancelTransitions()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := vm.StartContext(ctx)
+	assert.True(t, errors.Is(err, ErrQMPConnect))
+
+	// The process is killed
+	assert.True(t, errors.Is(vm.Wait(), ErrProcessExited))
+	assert.Equal(t, (<-vm.ExitStatus()).Code, -1)
+
+	// A failed startup is not a crash
+	assert.Equal(t, vm.State(), StateStopped)
+
+	states := []State{}
+
+	for transition := range transitions {
+		states = append(states, transition.To)
+	}
+
+	assert.Equal(t, states, []State{StateStarting, StateStopped})
+}
+
+// Creates a VM launched by l. The QMP ports allocated by NewVM are recycled,
+// the VM gets a free one instead.
+func newFakeVM(t *testing.T, config types.VMConfig, l launcher.Launcher) *VM {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	listener.Close()
+
+	vm := NewVM(config)
+	vm.Launcher = l
+	vm.Config.QMPServer.Addr = listener.Addr().String()
+
+	return vm
+}
+
+type launcherFunc func(config types.VMConfig) (launcher.Process, error)
+
+func (fn launcherFunc) Launch(config types.VMConfig) (launcher.Process, error) {
+	return fn(config)
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	vm := newFakeVM(t, types.VMConfig{
+		Id:   7,
+		NICs: []types.NIC{types.NICUser{MAC: "00:f0:00:00:00:01"}},
+	}, &launchertest.Launcher{})
+	vm.Logger = logger.NewText(&buf, logger.LevelInfo)
+
+	require.Nil(t, vm.Start())
+	assert.Nil(t, vm.Quit())
+	assert.Nil(t, vm.Wait())
+
+	fields := "vm_id=7 qmp_addr=" + vm.Config.QMPServer.Addr + " mac=00:f0:00:00:00:01"
+
+	assert.Contains(t, buf.String(), "level=INFO msg=Starting... "+fields+"\n")
+	assert.Contains(t, buf.String(), "level=INFO msg=Stopped "+fields+"\n")
+}